@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strconv"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -14,6 +16,8 @@ import (
 
 	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis"
 	"github.com/yard-turkey/cosi-prototype-driver/pkg/controller"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/webhook"
 	"github.com/yard-turkey/cosi-prototype-driver/version"
 
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
@@ -26,6 +30,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
@@ -36,9 +41,18 @@ var (
 	metricsHost               = "0.0.0.0"
 	metricsPort         int32 = 8383
 	operatorMetricsPort int32 = 8686
+	healthProbePort     int32 = 8081
+	webhookPort               = 9443
 )
 var log = logf.Log.WithName("cmd")
 
+// pluginDialTimeout bounds the wait for each plugin to come up at startup.
+const pluginDialTimeout = 30 * time.Second
+
+// webhookCertDirEnv names the directory holding the webhook server's tls.crt and tls.key.  The admission webhooks are
+// only served when it is set, since the server cannot start without a certificate.
+const webhookCertDirEnv = "COSI_WEBHOOK_CERT_DIR"
+
 func printVersion() {
 	log.Info(fmt.Sprintf("Operator Version: %s", version.Version))
 	log.Info(fmt.Sprintf("Go Version: %s", runtime.Version()))
@@ -92,8 +106,11 @@ func main() {
 
 	// Create a new Cmd to provide shared dependencies and start components
 	mgr, err := manager.New(cfg, manager.Options{
-		Namespace:          namespace,
-		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
+		Namespace:              namespace,
+		MetricsBindAddress:     fmt.Sprintf("%s:%d", metricsHost, metricsPort),
+		HealthProbeBindAddress: fmt.Sprintf("%s:%d", metricsHost, healthProbePort),
+		Port:                   webhookPort,
+		CertDir:                os.Getenv(webhookCertDirEnv),
 	})
 	if err != nil {
 		log.Error(err, "")
@@ -108,19 +125,67 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Connect to the provisioner plugins.  The connections are shared by all controllers and closed when the manager
+	// stops.  A plugin that is not up yet is retried in the background rather than failing startup.
+	endpoints, err := plugin.Endpoints()
+	if err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+	plugins, err := plugin.ConnectAll(ctx, endpoints, pluginDialTimeout)
+	if err != nil {
+		log.Error(err, "Failed to connect to plugins")
+		os.Exit(1)
+	}
+
+	// Probe each plugin's health in the background and report it on the readiness endpoint.  Liveness only covers
+	// the driver itself, since restarting it does not help a plugin that is down.
+	if err := mgr.Add(plugins); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+	for i, e := range endpoints {
+		name := e.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		if err := mgr.AddReadyzCheck("plugin-"+name, plugins.ReadyzCheck(e.Address)); err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
+	}
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
 	// Setup all Controllers
-	if err := controller.AddToManager(mgr); err != nil {
+	if err := controller.AddToManager(mgr, plugins); err != nil {
 		log.Error(err, "")
 		os.Exit(1)
 	}
 
+	// Setup all admission webhooks
+	if _, ok := os.LookupEnv(webhookCertDirEnv); ok {
+		if err := webhook.AddToManager(mgr, plugins); err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
+	} else {
+		log.Info("Admission webhooks disabled, " + webhookCertDirEnv + " is not set.")
+	}
+
 	// Add the Metrics Service
 	addMetrics(ctx, cfg, namespace)
 
 	log.Info("Starting the Cmd.")
 
 	// Start the Cmd
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+	err = mgr.Start(signals.SetupSignalHandler())
+	if closeErr := plugins.Close(); closeErr != nil {
+		log.Error(closeErr, "Failed to close plugin connections")
+	}
+	if err != nil {
 		log.Error(err, "Manager exited non-zero")
 		os.Exit(1)
 	}
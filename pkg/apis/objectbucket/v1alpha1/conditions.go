@@ -0,0 +1,91 @@
+/*
+Copyright 2019 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType names an aspect of provisioning reported in the status of ObjectBucketClaims and ObjectBuckets.
+type ConditionType string
+
+const (
+	// ConditionProvisioned reports whether the bucket exists in the object store.
+	ConditionProvisioned ConditionType = "Provisioned"
+	// ConditionCredentialsReady reports whether the claim's Secret has been written with the bucket credentials, and
+	// turns false again if they expire before they can be replaced.
+	ConditionCredentialsReady ConditionType = "CredentialsReady"
+	// ConditionConfigReady reports whether the claim's ConfigMap has been written with the bucket connection data.
+	ConditionConfigReady ConditionType = "ConfigReady"
+	// ConditionPluginReachable reports whether the last call to the provisioner plugin reached it.
+	ConditionPluginReachable ConditionType = "PluginReachable"
+	// ConditionInSync reports whether the claim's Secret and ConfigMap matched its ObjectBucket at the last resync.
+	ConditionInSync ConditionType = "InSync"
+	// ConditionObjectBucketDeleting is set on a claim whose ObjectBucket was deleted while the claim still uses it.  The
+	// ObjectBucket is kept, and the claim served, until the claim is deleted too.
+	ConditionObjectBucketDeleting ConditionType = "ObjectBucketDeleting"
+)
+
+// Condition follows the shape of the upstream metav1.Condition, which is not available in the apimachinery version
+// this project is pinned to.
+type Condition struct {
+	// Type of the condition, one of the ConditionType constants.
+	Type ConditionType `json:"type"`
+	// Status of the condition, one of True, False or Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+	// ObservedGeneration is the metadata.generation of the object the condition was set against.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastTransitionTime is the last time the condition changed from one status to another.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	// Reason is a CamelCase, programmatic identifier for the condition's last transition.
+	Reason string `json:"reason"`
+	// Message is a human readable explanation of the condition's last transition.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// SetCondition adds c to conditions, replacing any condition of the same type.  The LastTransitionTime of an existing
+// condition is kept if its status has not changed.
+func SetCondition(conditions *[]Condition, c Condition) {
+	if c.LastTransitionTime.IsZero() {
+		c.LastTransitionTime = metav1.Now()
+	}
+	for i := range *conditions {
+		existing := &(*conditions)[i]
+		if existing.Type != c.Type {
+			continue
+		}
+		if existing.Status == c.Status {
+			c.LastTransitionTime = existing.LastTransitionTime
+		}
+		*existing = c
+		return
+	}
+	*conditions = append(*conditions, c)
+}
+
+// FindCondition returns the condition of type t, or nil if it has not been set.
+func FindCondition(conditions []Condition, t ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == t {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	then := metav1.NewTime(time.Now().Add(-time.Hour))
+	existing := func() []Condition {
+		return []Condition{{
+			Type:               ConditionProvisioned,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: then,
+			Reason:             "Provisioning",
+		}}
+	}
+	tests := []struct {
+		name           string
+		conditions     []Condition
+		set            Condition
+		wantLen        int
+		wantTransition bool
+	}{
+		{
+			name:           "new condition type is appended",
+			conditions:     existing(),
+			set:            Condition{Type: ConditionConfigReady, Status: corev1.ConditionTrue, Reason: "ConfigMapCreated"},
+			wantLen:        2,
+			wantTransition: true,
+		}, {
+			name:           "same status keeps transition time",
+			conditions:     existing(),
+			set:            Condition{Type: ConditionProvisioned, Status: corev1.ConditionFalse, Reason: "ProvisionFailed"},
+			wantLen:        1,
+			wantTransition: false,
+		}, {
+			name:           "changed status moves transition time",
+			conditions:     existing(),
+			set:            Condition{Type: ConditionProvisioned, Status: corev1.ConditionTrue, Reason: "BucketProvisioned"},
+			wantLen:        1,
+			wantTransition: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetCondition(&tt.conditions, tt.set)
+			if len(tt.conditions) != tt.wantLen {
+				t.Fatalf("SetCondition() len = %d, want %d", len(tt.conditions), tt.wantLen)
+			}
+			got := FindCondition(tt.conditions, tt.set.Type)
+			if got == nil {
+				t.Fatalf("FindCondition() = nil, want %s", tt.set.Type)
+			}
+			if got.Reason != tt.set.Reason {
+				t.Errorf("SetCondition() reason = %q, want %q", got.Reason, tt.set.Reason)
+			}
+			if moved := !got.LastTransitionTime.Equal(&then); moved != tt.wantTransition {
+				t.Errorf("SetCondition() transition moved = %v, want %v", moved, tt.wantTransition)
+			}
+		})
+	}
+}
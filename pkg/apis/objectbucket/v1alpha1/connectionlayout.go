@@ -0,0 +1,97 @@
+/*
+Copyright 2019 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Default keys of the connection fields written to a claim's ConfigMap.
+const (
+	BucketEndpointKey = "COSI_BUCKET_ENDPOINT"
+	BucketRegionKey   = "COSI_BUCKET_REGION"
+	BucketNameKey     = "COSI_BUCKET_NAME"
+)
+
+// ConnectionFormat is a configuration file rendered from a bucket's connection, for applications that read one rather
+// than individual keys.
+type ConnectionFormat string
+
+const (
+	// ConnectionFormatAWSCredentials renders an AWS shared credentials file from S3 style key pairs into the Secret.
+	ConnectionFormatAWSCredentials ConnectionFormat = "AWSCredentials"
+	// ConnectionFormatAWSConfig renders an AWS config file with the bucket's region and endpoint into the ConfigMap.
+	ConnectionFormatAWSConfig ConnectionFormat = "AWSConfig"
+	// ConnectionFormatRclone renders an rclone config file with a remote for the bucket into the Secret.
+	ConnectionFormatRclone ConnectionFormat = "Rclone"
+	// ConnectionFormatJSON renders the connection and credentials as a single JSON document into the Secret.
+	ConnectionFormatJSON ConnectionFormat = "JSON"
+)
+
+// connectionFormatKeys are the default keys the formats are written under.
+var connectionFormatKeys = map[ConnectionFormat]string{
+	ConnectionFormatAWSCredentials: "credentials",
+	ConnectionFormatAWSConfig:      "config",
+	ConnectionFormatRclone:         "rclone.conf",
+	ConnectionFormatJSON:           "connection.json",
+}
+
+// Key returns the default key the format is written under, or "" if the format is not supported.
+func (f ConnectionFormat) Key() string {
+	return connectionFormatKeys[f]
+}
+
+// InSecret reports whether the format contains credentials and is written to the Secret rather than the ConfigMap.
+func (f ConnectionFormat) InSecret() bool {
+	return f != ConnectionFormatAWSConfig
+}
+
+// ConnectionLayout customizes the keys of a claim's Secret and ConfigMap for applications that expect other names than
+// the driver's defaults, or configuration files rather than individual keys.
+type ConnectionLayout struct {
+	// Keys renames the keys written by the driver, from the default key to the key the application expects, such as
+	// COSI_BUCKET_ENDPOINT to AWS_ENDPOINT_URL.  Formats are renamed by their default key as well.
+	// +optional
+	Keys map[string]string `json:"keys,omitempty"`
+	// Formats are the configuration files rendered in addition to the individual keys.
+	// +optional
+	Formats []ConnectionFormat `json:"formats,omitempty"`
+}
+
+// Key returns the key that the value of defaultKey is written under.
+func (l *ConnectionLayout) Key(defaultKey string) string {
+	if l != nil {
+		if k, ok := l.Keys[defaultKey]; ok {
+			return k
+		}
+	}
+	return defaultKey
+}
+
+// connectionKeys returns the default keys of the individual connection fields, mapped to whether each is written to the
+// Secret.
+func connectionKeys() map[string]bool {
+	return map[string]bool{
+		BucketEndpointKey:          false,
+		BucketRegionKey:            false,
+		BucketNameKey:              false,
+		AwsKeyField:                true,
+		AwsSecretField:             true,
+		AwsSessionTokenField:       true,
+		AwsSessionExpirationField:  true,
+		GcsServiceAccountKeyField:  true,
+		AzureAccountField:          true,
+		AzureSASTokenField:         true,
+		AzureConnectionStringField: true,
+	}
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"reflect"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -38,11 +41,59 @@ type mapper interface {
 // used for brownfield buckets, or the key to create an OB's
 // Authentication{}.
 const (
-	AwsKeyField        = "AWS_ACCESS_KEY_ID"
-	AwsSecretField     = "AWS_SECRET_ACCESS_KEY"
-	StorageClassBucket = "bucketName"
+	AwsKeyField    = "AWS_ACCESS_KEY_ID"
+	AwsSecretField = "AWS_SECRET_ACCESS_KEY"
+	// AwsSessionTokenField and AwsSessionExpirationField accompany the key pair of short-lived STS credentials.  The
+	// expiration is an RFC 3339 timestamp.
+	AwsSessionTokenField      = "AWS_SESSION_TOKEN"
+	AwsSessionExpirationField = "AWS_SESSION_EXPIRATION"
+	// GcsServiceAccountKeyField holds a GCS service account key in its JSON form.  The name suits mounting the Secret
+	// as a volume and pointing GOOGLE_APPLICATION_CREDENTIALS at the file.
+	GcsServiceAccountKeyField = "service-account.json"
+	// Azure storage credentials use the names of the environment variables read by the Azure SDKs and CLI.
+	AzureAccountField          = "AZURE_STORAGE_ACCOUNT"
+	AzureSASTokenField         = "AZURE_STORAGE_SAS_TOKEN"
+	AzureConnectionStringField = "AZURE_STORAGE_CONNECTION_STRING"
+	StorageClassBucket         = "bucketName"
+	// StorageClassAllowedClaimConfig is a comma separated list of the keys a claim's AdditionalConfig may set, or "*"
+	// to allow any key.  Claim values take precedence over StorageClass parameters of the same key.
+	StorageClassAllowedClaimConfig = "allowedClaimConfig"
+	// StorageClassNonEmptyBucketPolicy sets what deprovisioning does with a bucket that still holds objects, one of
+	// the NonEmptyBucketPolicy values.  It defaults to NonEmptyBucketFail.
+	StorageClassNonEmptyBucketPolicy = "nonEmptyBucketPolicy"
+	// StorageClassCredentialRotationPeriod sets how often the credentials of the class's buckets are rotated, as a
+	// duration such as "2160h" or a number of days such as "90d".  Credentials are not rotated on a schedule if unset.
+	StorageClassCredentialRotationPeriod = "credentialRotationPeriod"
+	// StorageClassCredentialRotationOverlap sets how long replaced credentials stay valid after a rotation, in the
+	// same format as StorageClassCredentialRotationPeriod.
+	StorageClassCredentialRotationOverlap = "credentialRotationOverlap"
+	// StorageClassConnectionKeys renames the keys of the claims' Secrets and ConfigMaps, as a comma separated list of
+	// default=name pairs such as "COSI_BUCKET_NAME=S3_BUCKET".  See ConnectionLayout.Keys.
+	StorageClassConnectionKeys = "connectionKeys"
+	// StorageClassConnectionFormats is a comma separated list of the ConnectionFormats rendered for the class's claims.
+	StorageClassConnectionFormats = "connectionFormats"
+	// RotateCredentialsAnnotation on a claim requests a rotation of its credentials.  Every new value requests another
+	// rotation, so a timestamp makes a convenient value.
+	RotateCredentialsAnnotation = "cosi.io/rotate-credentials"
 )
 
+// NonEmptyBucketPolicy is applied when the Delete reclaim policy meets a bucket the plugin reports is not empty.
+type NonEmptyBucketPolicy string
+
+const (
+	// NonEmptyBucketFail keeps the claim's finalizer and retries until the bucket has been emptied.
+	NonEmptyBucketFail NonEmptyBucketPolicy = "Fail"
+	// NonEmptyBucketForceEmpty asks the plugin to delete the bucket's objects along with the bucket.  Claims of the class
+	// are refused unless the plugin reports the FORCE_EMPTY capability.
+	NonEmptyBucketForceEmpty NonEmptyBucketPolicy = "ForceEmpty"
+	// NonEmptyBucketRetain leaves the bucket in place, as the Retain reclaim policy would.
+	NonEmptyBucketRetain NonEmptyBucketPolicy = "Retain"
+)
+
+// Finalizer is set on ObjectBucketClaims and ObjectBuckets bound by the driver.  It is removed once the bound bucket has
+// been released, so that neither object can be deleted out from under the other.
+const Finalizer = "cosi.io/finalizer"
+
 // AccessKeys is an Authentication type for passing AWS S3 style key pairs from the provisioner to the reconciler
 type AccessKeys struct {
 	// AccessKeyId is the S3 style access key to be written to a secret
@@ -60,22 +111,185 @@ func (ak *AccessKeys) toMap() map[string]string {
 	}
 }
 
+// SessionCredentials is an Authentication type for short-lived AWS STS credentials: a key pair that is only valid
+// together with its session token, and only until it expires.
+type SessionCredentials struct {
+	AccessKeyID     string `json:"-"`
+	SecretAccessKey string `json:"-"`
+	SessionToken    string `json:"-"`
+	// Expiration is when the credentials stop being valid.  It is zero if the plugin did not say.  Plugins that set it
+	// should support credential rotation, through which the driver replaces the credentials before then.
+	Expiration metav1.Time `json:"-"`
+}
+
+var _ mapper = &SessionCredentials{}
+
+func (sc *SessionCredentials) toMap() map[string]string {
+	m := map[string]string{
+		AwsKeyField:          sc.AccessKeyID,
+		AwsSecretField:       sc.SecretAccessKey,
+		AwsSessionTokenField: sc.SessionToken,
+	}
+	if !sc.Expiration.IsZero() {
+		m[AwsSessionExpirationField] = sc.Expiration.UTC().Format(time.RFC3339)
+	}
+	return m
+}
+
+// ServiceAccountKey is an Authentication type for GCS style service account keys.
+type ServiceAccountKey struct {
+	// JSON is the key file as issued by the store.
+	JSON string `json:"-"`
+}
+
+var _ mapper = &ServiceAccountKey{}
+
+func (sa *ServiceAccountKey) toMap() map[string]string {
+	return map[string]string{GcsServiceAccountKeyField: sa.JSON}
+}
+
+// AzureCredentials is an Authentication type for Azure storage, which grants access either through a SAS token for
+// the account or through a connection string embedding the account key.  Only the fields set are written.
+type AzureCredentials struct {
+	Account          string `json:"-"`
+	SASToken         string `json:"-"`
+	ConnectionString string `json:"-"`
+}
+
+var _ mapper = &AzureCredentials{}
+
+func (az *AzureCredentials) toMap() map[string]string {
+	m := make(map[string]string)
+	for k, v := range map[string]string{
+		AzureAccountField:          az.Account,
+		AzureSASTokenField:         az.SASToken,
+		AzureConnectionStringField: az.ConnectionString,
+	} {
+		if v != "" {
+			m[k] = v
+		}
+	}
+	return m
+}
+
 // Authentication wraps all supported auth types.  The design choice enables expansion of supported types while
 // protecting backwards compatibility.
 type Authentication struct {
-	AccessKeys           *AccessKeys       `json:"-"`
-	AdditionalSecretData map[string]string `json:"-"`
+	AccessKeys           *AccessKeys         `json:"-"`
+	SessionCredentials   *SessionCredentials `json:"-"`
+	ServiceAccountKey    *ServiceAccountKey  `json:"-"`
+	AzureCredentials     *AzureCredentials   `json:"-"`
+	AdditionalSecretData map[string]string   `json:"-"`
+}
+
+// NewAuthentication sorts credentials returned by a plugin into an Authentication, picking each auth type by the keys
+// of its Secret layout:
+//
+//	AccessKeys          AwsKeyField and AwsSecretField
+//	SessionCredentials  the same pair plus AwsSessionTokenField, and AwsSessionExpirationField if it parses
+//	ServiceAccountKey   GcsServiceAccountKeyField
+//	AzureCredentials    AzureAccountField and AzureSASTokenField, or AzureConnectionStringField, which names the
+//	                    account itself; AzureAccountField is kept alongside it if given
+//
+// Every other key is kept as AdditionalSecretData, as are the keys of an incomplete type, such as a lone access key.
+// ToMap of the result returns credentials unchanged, so the types can be recovered from a Secret written by ToMap.
+func NewAuthentication(credentials map[string]string) *Authentication {
+	a := &Authentication{AdditionalSecretData: make(map[string]string, len(credentials))}
+	for k, v := range credentials {
+		a.AdditionalSecretData[k] = v
+	}
+	has := func(keys ...string) bool {
+		for _, k := range keys {
+			if _, ok := credentials[k]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	take := func(keys ...string) {
+		for _, k := range keys {
+			delete(a.AdditionalSecretData, k)
+		}
+	}
+
+	switch {
+	case has(AwsKeyField, AwsSecretField, AwsSessionTokenField):
+		a.SessionCredentials = &SessionCredentials{
+			AccessKeyID:     credentials[AwsKeyField],
+			SecretAccessKey: credentials[AwsSecretField],
+			SessionToken:    credentials[AwsSessionTokenField],
+		}
+		take(AwsKeyField, AwsSecretField, AwsSessionTokenField)
+		if exp, err := time.Parse(time.RFC3339, credentials[AwsSessionExpirationField]); err == nil {
+			a.SessionCredentials.Expiration = metav1.NewTime(exp)
+			take(AwsSessionExpirationField)
+		}
+	case has(AwsKeyField, AwsSecretField):
+		a.AccessKeys = &AccessKeys{AccessKeyID: credentials[AwsKeyField], SecretAccessKey: credentials[AwsSecretField]}
+		take(AwsKeyField, AwsSecretField)
+	}
+	if has(GcsServiceAccountKeyField) {
+		a.ServiceAccountKey = &ServiceAccountKey{JSON: credentials[GcsServiceAccountKeyField]}
+		take(GcsServiceAccountKeyField)
+	}
+	if has(AzureAccountField, AzureSASTokenField) || has(AzureConnectionStringField) {
+		a.AzureCredentials = &AzureCredentials{
+			Account:          credentials[AzureAccountField],
+			SASToken:         credentials[AzureSASTokenField],
+			ConnectionString: credentials[AzureConnectionStringField],
+		}
+		take(AzureAccountField, AzureSASTokenField, AzureConnectionStringField)
+	}
+	return a
 }
 
-// ToMap converts the any defined authentication type into a map[string]string for writing to a Secret.StringData field
+// ToMap converts the defined authentication types into a map[string]string for writing to a Secret.StringData field.
+// AdditionalSecretData is written first and the typed auth types over it, so that a key the plugin also returned as
+// additional data cannot override the key pair it was recognised as.
 func (a *Authentication) ToMap() map[string]string {
+	m := map[string]string{}
 	if a == nil {
-		return map[string]string{}
+		return m
+	}
+	for k, v := range a.AdditionalSecretData {
+		m[k] = v
+	}
+	for _, typed := range a.mappers() {
+		for k, v := range typed.toMap() {
+			m[k] = v
+		}
 	}
+	return m
+}
+
+// mappers returns the typed auth types that are set.
+func (a *Authentication) mappers() []mapper {
+	var typed []mapper
 	if a.AccessKeys != nil {
-		return a.AccessKeys.toMap()
+		typed = append(typed, a.AccessKeys)
+	}
+	if a.SessionCredentials != nil {
+		typed = append(typed, a.SessionCredentials)
 	}
-	return map[string]string{}
+	if a.ServiceAccountKey != nil {
+		typed = append(typed, a.ServiceAccountKey)
+	}
+	if a.AzureCredentials != nil {
+		typed = append(typed, a.AzureCredentials)
+	}
+	return typed
+}
+
+// Types returns the names of the typed auth types that are set, for logging.
+func (a *Authentication) Types() []string {
+	var names []string
+	if a == nil {
+		return names
+	}
+	for _, typed := range a.mappers() {
+		names = append(names, reflect.TypeOf(typed).Elem().Name())
+	}
+	return names
 }
 
 // Endpoint contains all connection relevant data that an app may require for accessing
@@ -104,6 +318,14 @@ type ObjectBucketSpec struct {
 	StorageClassName string                                `json:"storageClassName"`
 	ReclaimPolicy    *corev1.PersistentVolumeReclaimPolicy `json:"reclaimPolicy"`
 	ClaimRef         *corev1.ObjectReference               `json:"claimRef"`
+	// CredentialsSecretRef references the Secret, owned by the OB, holding the credentials returned by the plugin.
+	// Since Authentication is not persisted, this is what the claim's Secret is regenerated from.
+	// +optional
+	CredentialsSecretRef *corev1.SecretReference `json:"credentialsSecretRef,omitempty"`
+	// ConnectionLayout is the layout of the claim's Secret and ConfigMap, resolved from the StorageClass and the claim
+	// when the bucket was provisioned.
+	// +optional
+	ConnectionLayout *ConnectionLayout `json:"connectionLayout,omitempty"`
 	*Connection      `json:",inline"`
 }
 
@@ -127,7 +349,50 @@ const (
 
 // ObjectBucketStatus defines the observed state of ObjectBucket
 type ObjectBucketStatus struct {
-	Phase      ObjectBucketStatusPhase `json:"phase"`
+	Phase ObjectBucketStatusPhase `json:"phase"`
+	// Conditions report the state of the bucket in the object store and of the last call to the plugin.
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+	// CredentialRotations is the history of the bucket's credential rotations, oldest first.  Only the most recent
+	// rotations are kept.
+	// +optional
+	CredentialRotations []CredentialRotation `json:"credentialRotations,omitempty"`
+}
+
+// CredentialRotationTrigger is what started a credential rotation.
+type CredentialRotationTrigger string
+
+const (
+	// CredentialRotationScheduled rotations are due by the StorageClassCredentialRotationPeriod.
+	CredentialRotationScheduled CredentialRotationTrigger = "Scheduled"
+	// CredentialRotationRequested rotations are requested with the RotateCredentialsAnnotation.
+	CredentialRotationRequested CredentialRotationTrigger = "Requested"
+	// CredentialRotationExpiring rotations replace session credentials shortly before they expire.
+	CredentialRotationExpiring CredentialRotationTrigger = "Expiring"
+)
+
+// CredentialRotation records the replacement of a bucket's credentials, and the revocation of the replaced ones once
+// the overlap window has passed.
+type CredentialRotation struct {
+	Trigger CredentialRotationTrigger `json:"trigger"`
+	// Request is the value of the RotateCredentialsAnnotation that requested the rotation, if any.
+	// +optional
+	Request string `json:"request,omitempty"`
+	// RotatedAt is when the new credentials were issued.
+	RotatedAt metav1.Time `json:"rotatedAt"`
+	// KeyID identifies the new credentials.
+	KeyID string `json:"keyID"`
+	// PreviousKeyID identifies the replaced credentials.
+	PreviousKeyID string `json:"previousKeyID"`
+	// RevokeAfter is the end of the overlap window, during which the replaced credentials remain valid.
+	RevokeAfter metav1.Time `json:"revokeAfter"`
+	// RevokedAt is when the replaced credentials were revoked, and is unset until they are.
+	// +optional
+	RevokedAt *metav1.Time `json:"revokedAt,omitempty"`
+	// Pending is set while the new credentials are being put in place of the replaced ones.  RotatedAt and RevokeAfter
+	// are set again once they are.
+	// +optional
+	Pending bool `json:"pending,omitempty"`
 }
 
 // +genclient
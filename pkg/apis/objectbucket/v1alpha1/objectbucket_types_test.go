@@ -19,6 +19,9 @@ package v1alpha1
 import (
 	"reflect"
 	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -60,25 +63,229 @@ func TestAccessKeys_toMap(t *testing.T) {
 	}
 }
 
+func TestSessionCredentials_toMap(t *testing.T) {
+	sc := &SessionCredentials{AccessKeyID: authKey, SecretAccessKey: authSecret, SessionToken: "test-token"}
+	want := map[string]string{
+		AwsKeyField:          authKey,
+		AwsSecretField:       authSecret,
+		AwsSessionTokenField: "test-token",
+	}
+	if got := sc.toMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SessionCredentials.toMap() = %v, want %v", got, want)
+	}
+
+	sc.Expiration = metav1.NewTime(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	want[AwsSessionExpirationField] = "2020-01-02T03:04:05Z"
+	if got := sc.toMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SessionCredentials.toMap() = %v, want %v", got, want)
+	}
+}
+
+func TestAzureCredentials_toMap(t *testing.T) {
+	tests := []struct {
+		name string
+		az   *AzureCredentials
+		want map[string]string
+	}{
+		{
+			name: "sas token",
+			az:   &AzureCredentials{Account: "account", SASToken: "sv=token"},
+			want: map[string]string{AzureAccountField: "account", AzureSASTokenField: "sv=token"},
+		}, {
+			name: "connection string",
+			az:   &AzureCredentials{ConnectionString: "AccountName=account"},
+			want: map[string]string{AzureConnectionStringField: "AccountName=account"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.az.toMap(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AzureCredentials.toMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAuthentication_ToMap(t *testing.T) {
 	type fields struct {
-		AccessKeys *AccessKeys
+		AccessKeys           *AccessKeys
+		AdditionalSecretData map[string]string
 	}
 	tests := []struct {
 		name   string
+		isNil  bool
 		fields fields
 		want   map[string]string
 	}{
-		// TODO: Add test cases.
+		{
+			name:  "nil authentication",
+			isNil: true,
+			want:  map[string]string{},
+		}, {
+			name:   "nothing defined",
+			fields: fields{},
+			want:   map[string]string{},
+		}, {
+			name: "access keys only",
+			fields: fields{
+				AccessKeys: &AccessKeys{AccessKeyID: authKey, SecretAccessKey: authSecret},
+			},
+			want: map[string]string{
+				AwsKeyField:    authKey,
+				AwsSecretField: authSecret,
+			},
+		}, {
+			name: "additional secret data only",
+			fields: fields{
+				AdditionalSecretData: map[string]string{"TOKEN": "test-token"},
+			},
+			want: map[string]string{"TOKEN": "test-token"},
+		}, {
+			name: "both sources merged",
+			fields: fields{
+				AccessKeys:           &AccessKeys{AccessKeyID: authKey, SecretAccessKey: authSecret},
+				AdditionalSecretData: map[string]string{"TOKEN": "test-token"},
+			},
+			want: map[string]string{
+				AwsKeyField:    authKey,
+				AwsSecretField: authSecret,
+				"TOKEN":        "test-token",
+			},
+		}, {
+			name: "access keys take precedence over additional secret data",
+			fields: fields{
+				AccessKeys:           &AccessKeys{AccessKeyID: authKey, SecretAccessKey: authSecret},
+				AdditionalSecretData: map[string]string{AwsKeyField: "other-key"},
+			},
+			want: map[string]string{
+				AwsKeyField:    authKey,
+				AwsSecretField: authSecret,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			a := &Authentication{
-				AccessKeys: tt.fields.AccessKeys,
+				AccessKeys:           tt.fields.AccessKeys,
+				AdditionalSecretData: tt.fields.AdditionalSecretData,
+			}
+			if tt.isNil {
+				a = nil
 			}
 			if got := a.ToMap(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Authentication.ToMap() = %v, want %v", got, tt.want)
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestNewAuthentication(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials map[string]string
+		want        *Authentication
+	}{
+		{
+			name:        "no credentials",
+			credentials: nil,
+			want:        &Authentication{AdditionalSecretData: map[string]string{}},
+		}, {
+			name: "s3 key pair",
+			credentials: map[string]string{
+				AwsKeyField:    authKey,
+				AwsSecretField: authSecret,
+				"TOKEN":        "test-token",
+			},
+			want: &Authentication{
+				AccessKeys:           &AccessKeys{AccessKeyID: authKey, SecretAccessKey: authSecret},
+				AdditionalSecretData: map[string]string{"TOKEN": "test-token"},
+			},
+		}, {
+			name: "sts session",
+			credentials: map[string]string{
+				AwsKeyField:               authKey,
+				AwsSecretField:            authSecret,
+				AwsSessionTokenField:      "test-token",
+				AwsSessionExpirationField: "2020-01-02T03:04:05Z",
+			},
+			want: &Authentication{
+				SessionCredentials: &SessionCredentials{
+					AccessKeyID:     authKey,
+					SecretAccessKey: authSecret,
+					SessionToken:    "test-token",
+					Expiration:      metav1.NewTime(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)),
+				},
+				AdditionalSecretData: map[string]string{},
+			},
+		}, {
+			name: "sts session with unparseable expiration",
+			credentials: map[string]string{
+				AwsKeyField:               authKey,
+				AwsSecretField:            authSecret,
+				AwsSessionTokenField:      "test-token",
+				AwsSessionExpirationField: "tomorrow",
+			},
+			want: &Authentication{
+				SessionCredentials: &SessionCredentials{
+					AccessKeyID:     authKey,
+					SecretAccessKey: authSecret,
+					SessionToken:    "test-token",
+				},
+				AdditionalSecretData: map[string]string{AwsSessionExpirationField: "tomorrow"},
+			},
+		}, {
+			name:        "gcs service account key",
+			credentials: map[string]string{GcsServiceAccountKeyField: `{"type": "service_account"}`},
+			want: &Authentication{
+				ServiceAccountKey:    &ServiceAccountKey{JSON: `{"type": "service_account"}`},
+				AdditionalSecretData: map[string]string{},
+			},
+		}, {
+			name: "azure sas token",
+			credentials: map[string]string{
+				AzureAccountField:  "account",
+				AzureSASTokenField: "sv=token",
+			},
+			want: &Authentication{
+				AzureCredentials:     &AzureCredentials{Account: "account", SASToken: "sv=token"},
+				AdditionalSecretData: map[string]string{},
+			},
+		}, {
+			name:        "azure connection string",
+			credentials: map[string]string{AzureConnectionStringField: "AccountName=account"},
+			want: &Authentication{
+				AzureCredentials:     &AzureCredentials{ConnectionString: "AccountName=account"},
+				AdditionalSecretData: map[string]string{},
+			},
+		}, {
+			name:        "azure sas token without account",
+			credentials: map[string]string{AzureSASTokenField: "sv=token"},
+			want: &Authentication{
+				AdditionalSecretData: map[string]string{AzureSASTokenField: "sv=token"},
+			},
+		}, {
+			name:        "azure account without credential",
+			credentials: map[string]string{AzureAccountField: "account"},
+			want: &Authentication{
+				AdditionalSecretData: map[string]string{AzureAccountField: "account"},
+			},
+		}, {
+			name:        "incomplete key pair",
+			credentials: map[string]string{AwsKeyField: authKey},
+			want: &Authentication{
+				AdditionalSecretData: map[string]string{AwsKeyField: authKey},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewAuthentication(tt.credentials)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewAuthentication() = %+v, want %+v", got, tt.want)
+			}
+			if len(tt.credentials) > 0 && !reflect.DeepEqual(got.ToMap(), tt.credentials) {
+				t.Errorf("NewAuthentication().ToMap() = %v, want the credentials back %v", got.ToMap(), tt.credentials)
+			}
+		})
+	}
+}
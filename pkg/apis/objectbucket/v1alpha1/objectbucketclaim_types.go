@@ -50,6 +50,11 @@ type ObjectBucketClaimSpec struct {
 	// +optional
 	AdditionalConfig map[string]string `json:"additionalConfig,omitempty"`
 
+	// ConnectionLayout customizes the keys of the claim's Secret and ConfigMap.  Keys it renames take precedence over
+	// those renamed by the StorageClass, and its formats replace the class's formats.
+	// +optional
+	ConnectionLayout *ConnectionLayout `json:"connectionLayout,omitempty"`
+
 	// ObjectBucketName is the name of the object bucket resource.  This is the authoritative
 	// determintaion for binding.
 	ObjectBucketName string
@@ -76,6 +81,17 @@ const (
 // ObjectBucketClaimStatus defines the observed state of ObjectBucketClaim
 type ObjectBucketClaimStatus struct {
 	Phase ObjectBucketClaimStatusPhase `json:"phase,omitempty"`
+	// Message is a human readable explanation of why the claim is in its current phase.  It is only set when the
+	// reconciler has rejected or failed the claim.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// ProvisionedBucketName is the bucket the plugin provisioned for the claim, or granted it access to.  It is
+	// recorded as soon as the plugin responds, so that the bucket is released even if the claim is never bound.
+	// +optional
+	ProvisionedBucketName string `json:"provisionedBucketName,omitempty"`
+	// Conditions report the progress of each provisioning step so that a Pending claim shows what it is waiting on.
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
 }
 
 // +genclient
@@ -94,6 +110,12 @@ type ObjectBucketClaim struct {
 	Status ObjectBucketClaimStatus `json:"status,omitempty"`
 }
 
+// IsBound returns true once provisioning has completed: the claim names its ObjectBucket and is in the Bound phase.  An
+// ObjectBucket name on a claim that is not yet Bound means provisioning was interrupted.
+func (obc *ObjectBucketClaim) IsBound() bool {
+	return obc.Spec.ObjectBucketName != "" && obc.Status.Phase == ObjectBucketClaimStatusPhaseBound
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // ObjectBucketClaimList contains a list of ObjectBucketClaim
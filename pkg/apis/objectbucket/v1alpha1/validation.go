@@ -0,0 +1,142 @@
+/*
+Copyright 2019 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// GeneratedBucketNameSuffixLen is the length of the random suffix appended to spec.generateBucketName, matching the
+// suffix the api server appends to metadata.generateName.
+const GeneratedBucketNameSuffixLen = 5
+
+// Bucket names follow the DNS-compatible naming rules of S3, which the other object stores accept as well.
+const (
+	minBucketNameLen = 3
+	maxBucketNameLen = 63
+)
+
+// ValidateBucketName returns an error if name is not a DNS-compatible bucket name: 3 to 63 lowercase letters, digits,
+// hyphens and periods, forming DNS labels, and not formatted as an IP address.
+func ValidateBucketName(name string) error {
+	if len(name) < minBucketNameLen || len(name) > maxBucketNameLen {
+		return fmt.Errorf("bucket name %q must be between %d and %d characters long", name, minBucketNameLen, maxBucketNameLen)
+	}
+	if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+		return fmt.Errorf("bucket name %q is not DNS-compatible: %s", name, strings.Join(msgs, "; "))
+	}
+	if net.ParseIP(name) != nil {
+		return fmt.Errorf("bucket name %q must not be formatted as an IP address", name)
+	}
+	return nil
+}
+
+// ValidateGenerateBucketName returns an error if bucket names generated from prefix would not be DNS-compatible.
+func ValidateGenerateBucketName(prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("bucket name prefix must not be empty")
+	}
+	// The generated suffix is lowercase alphanumeric, so validating the prefix with a stand-in suffix covers every
+	// name it can generate.
+	err := ValidateBucketName(fmt.Sprintf("%s-%s", prefix, strings.Repeat("x", GeneratedBucketNameSuffixLen)))
+	if err != nil {
+		return fmt.Errorf("bucket name prefix %q does not generate valid bucket names: %v", prefix, err)
+	}
+	return nil
+}
+
+// ValidateBrownfieldClaim returns an error if obc asks for a bucket other than bucket, the existing bucket named by its
+// StorageClass.
+func ValidateBrownfieldClaim(obc *ObjectBucketClaim, bucket string) error {
+	if obc.Spec.GenerateBucketName != "" {
+		return fmt.Errorf("spec.generateBucketName cannot be used with StorageClass %q, which binds the existing bucket %q",
+			obc.Spec.StorageClassName, bucket)
+	}
+	if obc.Spec.BucketName != "" && obc.Spec.BucketName != bucket {
+		return fmt.Errorf("spec.bucketName %q does not match the existing bucket %q of StorageClass %q",
+			obc.Spec.BucketName, bucket, obc.Spec.StorageClassName)
+	}
+	return nil
+}
+
+// ValidateConnectionLayout returns an error if layout renders an unsupported format, renames a key the driver does not
+// write or renames one to an invalid key, or writes two values under the same key of the Secret or ConfigMap.
+// Collisions with the plugin's connection data can only be found once the bucket has been provisioned.
+func ValidateConnectionLayout(layout *ConnectionLayout) error {
+	if layout == nil {
+		return nil
+	}
+	var errs []string
+	written := connectionKeys()
+	renamable := make(map[string]bool, len(written)+len(connectionFormatKeys))
+	for k := range written {
+		renamable[k] = true
+	}
+	for _, k := range connectionFormatKeys {
+		renamable[k] = true
+	}
+	formats := make(map[ConnectionFormat]bool, len(layout.Formats))
+	for _, f := range layout.Formats {
+		switch {
+		case f.Key() == "":
+			errs = append(errs, fmt.Sprintf("unsupported format %q", f))
+		case formats[f]:
+			errs = append(errs, fmt.Sprintf("format %q is listed more than once", f))
+		default:
+			written[f.Key()] = f.InSecret()
+		}
+		formats[f] = true
+	}
+	for from, to := range layout.Keys {
+		if !renamable[from] {
+			errs = append(errs, fmt.Sprintf("%q is not a key written by the driver", from))
+		}
+		if msgs := validation.IsConfigMapKey(to); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("%q is not a valid key: %s", to, strings.Join(msgs, "; ")))
+		}
+	}
+
+	// Keys of the Secret and the ConfigMap are distinct, so a key may appear in both.
+	defaults := make([]string, 0, len(written))
+	for k := range written {
+		defaults = append(defaults, k)
+	}
+	sort.Strings(defaults)
+	owners := make(map[bool]map[string]string)
+	for _, from := range defaults {
+		inSecret := written[from]
+		if owners[inSecret] == nil {
+			owners[inSecret] = make(map[string]string)
+		}
+		to := layout.Key(from)
+		if other, ok := owners[inSecret][to]; ok {
+			errs = append(errs, fmt.Sprintf("%q and %q are both written under key %q", other, from, to))
+			continue
+		}
+		owners[inSecret][to] = from
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("invalid connection layout: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
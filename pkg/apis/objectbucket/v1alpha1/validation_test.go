@@ -0,0 +1,156 @@
+/*
+Copyright 2019 Red Hat Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateBucketName(t *testing.T) {
+	tests := []struct {
+		name    string
+		bucket  string
+		wantErr bool
+	}{
+		{name: "valid", bucket: "my-bucket.1"},
+		{name: "too short", bucket: "ab", wantErr: true},
+		{name: "too long", bucket: strings.Repeat("a", 64), wantErr: true},
+		{name: "uppercase", bucket: "My-Bucket", wantErr: true},
+		{name: "underscore", bucket: "my_bucket", wantErr: true},
+		{name: "leading hyphen", bucket: "-bucket", wantErr: true},
+		{name: "trailing period", bucket: "bucket.", wantErr: true},
+		{name: "adjacent periods", bucket: "my..bucket", wantErr: true},
+		{name: "ip address", bucket: "192.168.1.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateBucketName(tt.bucket); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateBucketName(%q) error = %v, wantErr %v", tt.bucket, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateGenerateBucketName(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		wantErr bool
+	}{
+		{name: "valid", prefix: "logs"},
+		{name: "short prefix", prefix: "a"},
+		{name: "empty", prefix: "", wantErr: true},
+		{name: "longest", prefix: strings.Repeat("a", 63-1-GeneratedBucketNameSuffixLen)},
+		{name: "too long", prefix: strings.Repeat("a", 63-GeneratedBucketNameSuffixLen), wantErr: true},
+		{name: "uppercase", prefix: "Logs", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateGenerateBucketName(tt.prefix); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateGenerateBucketName(%q) error = %v, wantErr %v", tt.prefix, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateBrownfieldClaim(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    ObjectBucketClaimSpec
+		wantErr bool
+	}{
+		{name: "no name", spec: ObjectBucketClaimSpec{}},
+		{name: "existing bucket", spec: ObjectBucketClaimSpec{BucketName: "existing"}},
+		{name: "other bucket", spec: ObjectBucketClaimSpec{BucketName: "other"}, wantErr: true},
+		{name: "prefix", spec: ObjectBucketClaimSpec{GenerateBucketName: "existing"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.spec.StorageClassName = "brownfield"
+			if err := ValidateBrownfieldClaim(&ObjectBucketClaim{Spec: tt.spec}, "existing"); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateBrownfieldClaim() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConnectionLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		layout  *ConnectionLayout
+		wantErr bool
+	}{
+		{name: "default"},
+		{
+			name: "renamed keys and formats",
+			layout: &ConnectionLayout{
+				Keys: map[string]string{
+					BucketEndpointKey: "AWS_ENDPOINT_URL",
+					BucketNameKey:     "S3_BUCKET",
+					"config":          "aws-config",
+				},
+				Formats: []ConnectionFormat{ConnectionFormatAWSCredentials, ConnectionFormatAWSConfig},
+			},
+		},
+		{
+			name:   "same key in the Secret and the ConfigMap",
+			layout: &ConnectionLayout{Keys: map[string]string{BucketNameKey: AwsKeyField}},
+		},
+		{
+			name:   "renamed to an unused format key",
+			layout: &ConnectionLayout{Keys: map[string]string{BucketNameKey: "config"}},
+		},
+		{
+			name:    "renamed to a used format key",
+			layout:  &ConnectionLayout{Keys: map[string]string{BucketNameKey: "config"}, Formats: []ConnectionFormat{ConnectionFormatAWSConfig}},
+			wantErr: true,
+		},
+		{
+			name:    "renamed to another default key",
+			layout:  &ConnectionLayout{Keys: map[string]string{AwsSecretField: AwsKeyField}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			layout:  &ConnectionLayout{Keys: map[string]string{"BUCKET": "S3_BUCKET"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid key",
+			layout:  &ConnectionLayout{Keys: map[string]string{BucketNameKey: "s3 bucket"}},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported format",
+			layout:  &ConnectionLayout{Formats: []ConnectionFormat{"YAML"}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate format",
+			layout:  &ConnectionLayout{Formats: []ConnectionFormat{ConnectionFormatJSON, ConnectionFormatJSON}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateConnectionLayout(tt.layout); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateConnectionLayout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
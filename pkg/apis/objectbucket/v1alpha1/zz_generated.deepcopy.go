@@ -33,6 +33,21 @@ func (in *Authentication) DeepCopyInto(out *Authentication) {
 		*out = new(AccessKeys)
 		**out = **in
 	}
+	if in.SessionCredentials != nil {
+		in, out := &in.SessionCredentials, &out.SessionCredentials
+		*out = new(SessionCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccountKey != nil {
+		in, out := &in.ServiceAccountKey, &out.ServiceAccountKey
+		*out = new(ServiceAccountKey)
+		**out = **in
+	}
+	if in.AzureCredentials != nil {
+		in, out := &in.AzureCredentials, &out.AzureCredentials
+		*out = new(AzureCredentials)
+		**out = **in
+	}
 	if in.AdditionalSecretData != nil {
 		in, out := &in.AdditionalSecretData, &out.AdditionalSecretData
 		*out = make(map[string]string, len(*in))
@@ -53,6 +68,39 @@ func (in *Authentication) DeepCopy() *Authentication {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureCredentials) DeepCopyInto(out *AzureCredentials) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureCredentials.
+func (in *AzureCredentials) DeepCopy() *AzureCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Connection) DeepCopyInto(out *Connection) {
 	*out = *in
@@ -86,6 +134,56 @@ func (in *Connection) DeepCopy() *Connection {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConnectionLayout) DeepCopyInto(out *ConnectionLayout) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Formats != nil {
+		in, out := &in.Formats, &out.Formats
+		*out = make([]ConnectionFormat, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectionLayout.
+func (in *ConnectionLayout) DeepCopy() *ConnectionLayout {
+	if in == nil {
+		return nil
+	}
+	out := new(ConnectionLayout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialRotation) DeepCopyInto(out *CredentialRotation) {
+	*out = *in
+	in.RotatedAt.DeepCopyInto(&out.RotatedAt)
+	in.RevokeAfter.DeepCopyInto(&out.RevokeAfter)
+	if in.RevokedAt != nil {
+		in, out := &in.RevokedAt, &out.RevokedAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialRotation.
+func (in *CredentialRotation) DeepCopy() *CredentialRotation {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialRotation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Endpoint) DeepCopyInto(out *Endpoint) {
 	*out = *in
@@ -115,7 +213,7 @@ func (in *ObjectBucket) DeepCopyInto(out *ObjectBucket) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -143,7 +241,7 @@ func (in *ObjectBucketClaim) DeepCopyInto(out *ObjectBucketClaim) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -208,6 +306,11 @@ func (in *ObjectBucketClaimSpec) DeepCopyInto(out *ObjectBucketClaimSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.ConnectionLayout != nil {
+		in, out := &in.ConnectionLayout, &out.ConnectionLayout
+		*out = new(ConnectionLayout)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -224,6 +327,13 @@ func (in *ObjectBucketClaimSpec) DeepCopy() *ObjectBucketClaimSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ObjectBucketClaimStatus) DeepCopyInto(out *ObjectBucketClaimStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -283,6 +393,16 @@ func (in *ObjectBucketSpec) DeepCopyInto(out *ObjectBucketSpec) {
 		*out = new(v1.ObjectReference)
 		**out = **in
 	}
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(v1.SecretReference)
+		**out = **in
+	}
+	if in.ConnectionLayout != nil {
+		in, out := &in.ConnectionLayout, &out.ConnectionLayout
+		*out = new(ConnectionLayout)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Connection != nil {
 		in, out := &in.Connection, &out.Connection
 		*out = new(Connection)
@@ -304,6 +424,20 @@ func (in *ObjectBucketSpec) DeepCopy() *ObjectBucketSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ObjectBucketStatus) DeepCopyInto(out *ObjectBucketStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CredentialRotations != nil {
+		in, out := &in.CredentialRotations, &out.CredentialRotations
+		*out = make([]CredentialRotation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -316,3 +450,36 @@ func (in *ObjectBucketStatus) DeepCopy() *ObjectBucketStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountKey) DeepCopyInto(out *ServiceAccountKey) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountKey.
+func (in *ServiceAccountKey) DeepCopy() *ServiceAccountKey {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SessionCredentials) DeepCopyInto(out *SessionCredentials) {
+	*out = *in
+	in.Expiration.DeepCopyInto(&out.Expiration)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SessionCredentials.
+func (in *SessionCredentials) DeepCopy() *SessionCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(SessionCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
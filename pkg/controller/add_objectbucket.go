@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucket"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
+)
+
+func init() {
+	// AddToManagerFuncs is a list of functions to create controllers and add them to a manager.
+	// The objectbucket controller never calls the plugin.
+	AddToManagerFuncs = append(AddToManagerFuncs, func(m manager.Manager, _ *plugin.Registry) error {
+		return objectbucket.Add(m)
+	})
+}
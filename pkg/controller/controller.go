@@ -2,15 +2,17 @@ package controller
 
 import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
 )
 
 // AddToManagerFuncs is a list of functions to add all Controllers to the Manager
-var AddToManagerFuncs []func(manager.Manager) error
+var AddToManagerFuncs []func(manager.Manager, *plugin.Registry) error
 
-// AddToManager adds all Controllers to the Manager
-func AddToManager(m manager.Manager) error {
+// AddToManager adds all Controllers to the Manager.  Controllers that call plugins find them in registry.
+func AddToManager(m manager.Manager, registry *plugin.Registry) error {
 	for _, f := range AddToManagerFuncs {
-		if err := f(m); err != nil {
+		if err := f(m, registry); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,171 @@
+package objectbucket
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectutil"
+)
+
+var log = logf.Log.WithName("controller_objectbucket")
+
+// Event reasons recorded when the deletion of a bound OB is blocked.
+const (
+	eventDeletionBlocked             = "DeletionBlocked"
+	eventObjectBucketDeletionBlocked = "ObjectBucketDeletionBlocked"
+)
+
+// Add creates a new ObjectBucket Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+//
+// The controller guards the finalizer the objectbucketclaim controller sets on ObjectBuckets.  The finalizer keeps a
+// deleted OB in place for as long as it is bound to a live claim, and is only released once the claim's bucket has
+// been deprovisioned.  A deleted OB cannot be restored, so it is not recreated: the claim keeps its bucket and
+// credentials, and reports the pending deletion through its ObjectBucketDeleting condition, until the claim itself is
+// deleted.  Recreating the claim then provisions a new OB.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileObjectBucket{
+		client:   mgr.GetClient(),
+		recorder: mgr.GetEventRecorderFor("cosi-prototype-driver"),
+		ctx:      context.Background(),
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	c, err := controller.New("objectbucket-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &v1alpha1.ObjectBucket{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to claims and requeue the OB they are bound to, so that a deleted OB is released as soon as
+	// its claim is gone
+	return c.Watch(&source.Kind{Type: &v1alpha1.ObjectBucketClaim{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(objectBucketForClaim),
+	})
+}
+
+// objectBucketForClaim maps a claim to the OB it names.
+func objectBucketForClaim(o handler.MapObject) []reconcile.Request {
+	obc, ok := o.Object.(*v1alpha1.ObjectBucketClaim)
+	if !ok || obc.Spec.ObjectBucketName == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: obc.Spec.ObjectBucketName}}}
+}
+
+// blank assignment to verify that ReconcileObjectBucket implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileObjectBucket{}
+
+// ReconcileObjectBucket reconciles an ObjectBucket object
+type ReconcileObjectBucket struct {
+	client   client.Client
+	recorder record.EventRecorder
+	ctx      context.Context
+}
+
+// Reconcile ensures bound OBs carry the finalizer, and decides whether a deleted OB's finalizer may be released.
+func (r *ReconcileObjectBucket) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Request.Name", request.Name)
+	reqLogger.V(1).Info("Reconciling ObjectBucket")
+
+	ob := &v1alpha1.ObjectBucket{}
+	err := r.client.Get(r.ctx, request.NamespacedName, ob)
+	if err != nil {
+		if apierrs.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	claim, err := r.boundClaim(ob)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if ob.DeletionTimestamp == nil {
+		// OBs created before the driver set finalizers on them are brought under protection here.
+		if claim != nil && claim.DeletionTimestamp == nil && !objectutil.HasFinalizer(ob, v1alpha1.Finalizer) {
+			reqLogger.Info("adding finalizer to bound object bucket")
+			return reconcile.Result{}, r.patchFinalizer(ob, controllerutil.AddFinalizer)
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if !objectutil.HasFinalizer(ob, v1alpha1.Finalizer) {
+		return reconcile.Result{}, nil
+	}
+	switch {
+	case claim != nil && claim.DeletionTimestamp == nil:
+		// The objectbucketclaim controller, which owns the claim's status, sets its ObjectBucketDeleting condition.
+		reqLogger.Info("blocking deletion of object bucket bound to a live claim",
+			"Claim.Namespace", claim.Namespace, "Claim.Name", claim.Name)
+		msg := fmt.Sprintf("ObjectBucket %q is bound to claim %s/%s and will not be deleted until the claim is",
+			ob.Name, claim.Namespace, claim.Name)
+		r.recorder.Event(ob, corev1.EventTypeWarning, eventDeletionBlocked, msg)
+		r.recorder.Event(claim, corev1.EventTypeWarning, eventObjectBucketDeletionBlocked, msg)
+		return reconcile.Result{}, nil
+	case claim != nil:
+		// The claim is being deleted.  The objectbucketclaim controller releases the finalizer once it has
+		// deprovisioned the bucket.
+		reqLogger.V(1).Info("waiting for claim deprovisioning to finish")
+		return reconcile.Result{}, nil
+	}
+	// The claim is gone, which the claim's own finalizer only allows after deprovisioning, or it was never bound to
+	// this OB.
+	reqLogger.Info("releasing object bucket finalizer")
+	return reconcile.Result{}, r.patchFinalizer(ob, controllerutil.RemoveFinalizer)
+}
+
+// boundClaim returns the claim referenced by ob's claimRef if it still exists and is bound to ob, otherwise nil.  A
+// claim recreated under the same name has a different UID and is not considered bound.
+func (r *ReconcileObjectBucket) boundClaim(ob *v1alpha1.ObjectBucket) (*v1alpha1.ObjectBucketClaim, error) {
+	ref := ob.Spec.ClaimRef
+	if ref == nil {
+		return nil, nil
+	}
+	claim := &v1alpha1.ObjectBucketClaim{}
+	err := r.client.Get(r.ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, claim)
+	if apierrs.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if claim.UID != ref.UID || claim.Spec.ObjectBucketName != ob.Name {
+		return nil, nil
+	}
+	return claim, nil
+}
+
+// patchFinalizer applies mutate with the driver's finalizer and writes the change as a merge patch.  The patch
+// carries ob's resourceVersion so that a stale ob results in a Conflict, and a requeue, rather than overwriting
+// finalizers set by others.
+func (r *ReconcileObjectBucket) patchFinalizer(ob *v1alpha1.ObjectBucket, mutate func(o metav1.Object, finalizer string)) error {
+	patch := objectutil.MergeFromWithOptimisticLock(ob)
+	mutate(ob, v1alpha1.Finalizer)
+	return r.client.Patch(r.ctx, ob, patch)
+}
@@ -0,0 +1,171 @@
+package objectbucket
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectutil"
+)
+
+func TestReconcile(t *testing.T) {
+	// The fake client decodes objects with the client-go scheme, so the driver's types are registered there too.
+	if err := v1alpha1.AddToScheme(clientgoscheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	now := metav1.Now()
+	claim := func(uid types.UID, deleted bool) *v1alpha1.ObjectBucketClaim {
+		obc := &v1alpha1.ObjectBucketClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: "my-claim", UID: uid},
+			Spec:       v1alpha1.ObjectBucketClaimSpec{ObjectBucketName: "my-ob"},
+		}
+		if deleted {
+			obc.DeletionTimestamp = &now
+			obc.Finalizers = []string{v1alpha1.Finalizer}
+		}
+		return obc
+	}
+
+	tests := []struct {
+		name string
+		// claim is the claim the OB is bound to, if it exists.
+		claim     *v1alpha1.ObjectBucketClaim
+		finalizer bool
+		deleted   bool
+		// wantFinalizer is whether the OB holds the finalizer once reconciled.
+		wantFinalizer bool
+		wantEvents    int
+	}{
+		{
+			name:          "bound OB is given the finalizer",
+			claim:         claim("uid-1", false),
+			wantFinalizer: true,
+		},
+		{
+			name:  "unbound OB is not given the finalizer",
+			claim: claim("uid-2", false),
+		},
+		{
+			name:          "deletion of an OB bound to a live claim is blocked",
+			claim:         claim("uid-1", false),
+			finalizer:     true,
+			deleted:       true,
+			wantFinalizer: true,
+			wantEvents:    2,
+		},
+		{
+			name:          "deleted OB waits for its claim to be deprovisioned",
+			claim:         claim("uid-1", true),
+			finalizer:     true,
+			deleted:       true,
+			wantFinalizer: true,
+		},
+		{
+			name:      "deleted OB of a deleted claim is released",
+			finalizer: true,
+			deleted:   true,
+		},
+		{
+			name:      "deleted OB of a recreated claim is released",
+			claim:     claim("uid-2", false),
+			finalizer: true,
+			deleted:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := &v1alpha1.ObjectBucket{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-ob"},
+				Spec: v1alpha1.ObjectBucketSpec{
+					ClaimRef: &corev1.ObjectReference{Namespace: "my-ns", Name: "my-claim", UID: "uid-1"},
+				},
+			}
+			if tt.finalizer {
+				ob.Finalizers = []string{v1alpha1.Finalizer}
+			}
+			if tt.deleted {
+				ob.DeletionTimestamp = &now
+			}
+			objs := []runtime.Object{ob}
+			if tt.claim != nil {
+				objs = append(objs, tt.claim)
+			}
+			recorder := record.NewFakeRecorder(10)
+			r := &ReconcileObjectBucket{
+				client:   fake.NewFakeClientWithScheme(clientgoscheme.Scheme, objs...),
+				recorder: recorder,
+				ctx:      context.Background(),
+			}
+
+			if _, err := r.Reconcile(reconcile.Request{NamespacedName: client.ObjectKey{Name: ob.Name}}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			got := &v1alpha1.ObjectBucket{}
+			if err := r.client.Get(r.ctx, client.ObjectKey{Name: ob.Name}, got); err != nil {
+				t.Fatal(err)
+			}
+			if has := objectutil.HasFinalizer(got, v1alpha1.Finalizer); has != tt.wantFinalizer {
+				t.Errorf("OB has finalizer = %v, want %v", has, tt.wantFinalizer)
+			}
+			if len(recorder.Events) != tt.wantEvents {
+				t.Errorf("recorded %d events, want %d", len(recorder.Events), tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestClaimDeletedAfterObjectBucket(t *testing.T) {
+	if err := v1alpha1.AddToScheme(clientgoscheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	now := metav1.Now()
+	ob := &v1alpha1.ObjectBucket{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-ob", Finalizers: []string{v1alpha1.Finalizer}, DeletionTimestamp: &now},
+		Spec: v1alpha1.ObjectBucketSpec{
+			ClaimRef: &corev1.ObjectReference{Namespace: "my-ns", Name: "my-claim", UID: "uid-1"},
+		},
+	}
+	obc := &v1alpha1.ObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: "my-claim", UID: "uid-1"},
+		Spec:       v1alpha1.ObjectBucketClaimSpec{ObjectBucketName: "my-ob"},
+	}
+	r := &ReconcileObjectBucket{
+		client:   fake.NewFakeClientWithScheme(clientgoscheme.Scheme, ob, obc),
+		recorder: record.NewFakeRecorder(10),
+		ctx:      context.Background(),
+	}
+	key := client.ObjectKey{Name: ob.Name}
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// The claim goes away, as when it is released under the Retain policy, and its delete event requeues the OB.
+	if err := r.client.Delete(r.ctx, obc); err != nil {
+		t.Fatal(err)
+	}
+	requests := objectBucketForClaim(handler.MapObject{Meta: obc, Object: obc})
+	if len(requests) != 1 || requests[0].NamespacedName != key {
+		t.Fatalf("objectBucketForClaim() = %v, want a request for %s", requests, key)
+	}
+	if _, err := r.Reconcile(requests[0]); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	got := &v1alpha1.ObjectBucket{}
+	if err := r.client.Get(r.ctx, key, got); err != nil {
+		t.Fatal(err)
+	}
+	if objectutil.HasFinalizer(got, v1alpha1.Finalizer) {
+		t.Error("OB still holds the finalizer after its claim was deleted")
+	}
+}
@@ -0,0 +1,20 @@
+package objectbucketclaim
+
+import (
+	"context"
+
+	"github.com/yard-turkey/cosi-prototype-interface/cosi"
+)
+
+// accessClient issues and revokes credentials for a bucket that already exists, without ever creating or deleting it,
+// as brownfield buckets and credential rotation need.  The cosi Provisioner service has no RPCs for either yet.  A
+// plugin unaware of Provision or Deprovision calls repurposed for them would create or delete the bucket instead, so
+// plugins are not asked: no plugin has an accessClient until cosi-prototype-interface defines GrantAccess and
+// RevokeAccess and registrySource wraps the generated client in one.
+type accessClient interface {
+	// grantAccess issues new credentials for the existing bucket, leaving those issued before valid.
+	grantAccess(ctx context.Context, bucket string, params map[string]string) (*cosi.ProvisionResponse, error)
+	// revokeAccess revokes the credentials with keyID from the bucket, and no others.  Credentials the plugin does not
+	// know are reported with a NotFound status.
+	revokeAccess(ctx context.Context, bucket, keyID string) error
+}
@@ -0,0 +1,127 @@
+package objectbucketclaim
+
+import (
+	"errors"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	. "github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucketclaim/requestLogger"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
+)
+
+// A StorageClass that names an existing bucket with the v1alpha1.StorageClassBucket parameter binds its claims to that
+// bucket ("brownfield") instead of creating a new one ("greenfield").  Access to the bucket is granted and revoked
+// through the plugin's accessClient, never with Provision or Deprovision, and only by plugins that support
+// plugin.CapabilityBrownfield.  Several claims may share the bucket, so its access is revoked by credential key ID.
+
+// brownfieldAnnotation marks an OB as bound to a pre-existing bucket, so that deprovisioning does not depend on the
+// StorageClass, which may have changed since the claim was bound.
+const (
+	brownfieldAnnotation      = "cosi.io/brownfield"
+	brownfieldAnnotationValue = "true"
+)
+
+// brownfieldBucket returns the existing bucket named by the StorageClass, if any.
+func brownfieldBucket(sc *storagev1.StorageClass) (string, bool) {
+	name, ok := sc.Parameters[v1alpha1.StorageClassBucket]
+	return name, ok && name != ""
+}
+
+func isBrownfieldObjectBucket(ob *v1alpha1.ObjectBucket) bool {
+	return ob.Annotations[brownfieldAnnotation] == brownfieldAnnotationValue
+}
+
+var (
+	errNoRevokeCapability = errors.New("the plugin does not support brownfield buckets, so it is not asked to revoke access")
+	errNoRevokeKeyID      = errors.New("the claim's credentials have no key ID to revoke them by")
+)
+
+// revokeBucketAccess is the brownfield counterpart of deleteBucket.  The claim's credentials are revoked and the OB
+// deleted, but the bucket itself, and the access of other claims to it, are left in place whatever the reclaim policy
+// says.  A plugin that does not support plugin.CapabilityBrownfield is never asked; the claim keeps its finalizer until
+// the plugin supports it or access has been revoked by hand and the finalizer removed.
+func (r *ReconcileObjectBucketClaim) revokeBucketAccess(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, p *pluginClient) error {
+	if ob == nil && obc.Status.ProvisionedBucketName == "" && r.transactions.get(obc.UID).provisioned == nil {
+		Debug.Info("claim is unbound and was never granted access, nothing to revoke")
+		return nil
+	}
+	bucket := r.releasedBucketName(obc, ob)
+	if tx := r.transactions.get(obc.UID); ob == nil && tx.provisioned != nil {
+		bucket = tx.provisioned.BucketName
+	}
+	if !p.supports(plugin.CapabilityBrownfield) {
+		return r.reportRevokeFailure(obc, ob, errNoRevokeCapability)
+	}
+	keyIDs, err := r.claimKeyIDs(obc, ob)
+	if err != nil {
+		return r.reportRevokeFailure(obc, ob, err)
+	}
+	if len(keyIDs) == 0 {
+		// Provisioning stopped before the credentials were published, and the transaction holding them was lost.
+		Log.Info("credentials of the claim are unknown, nothing to revoke", "BucketName", bucket)
+		r.recorder.Eventf(obc, corev1.EventTypeWarning, eventDeprovisionFailed,
+			"the credentials granted access to bucket %q are unknown and were not revoked", bucket)
+	}
+	for _, keyID := range keyIDs {
+		if err := r.revokeKey(obc, p, bucket, keyID); err != nil {
+			if ob != nil {
+				setObjectBucketPluginReachable(ob, err)
+			}
+			return r.reportRevokeFailure(obc, ob, err)
+		}
+	}
+	r.recorder.Eventf(obc, corev1.EventTypeNormal, eventAccessRevoked, "access to bucket %q revoked", bucket)
+
+	if ob == nil {
+		return nil
+	}
+	return r.deleteObjectBucket(ob)
+}
+
+// claimKeyIDs returns the key IDs of the credentials to revoke from the claim's brownfield bucket: the current ones,
+// and those replaced by a rotation whose overlap has not ended.  It returns none if the claim was never bound and its
+// credentials are unknown.
+func (r *ReconcileObjectBucketClaim) claimKeyIDs(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket) ([]string, error) {
+	var auth *v1alpha1.Authentication
+	switch tx := r.transactions.get(obc.UID); {
+	case ob != nil:
+		var err error
+		if auth, err = r.objectBucketCredentials(ob); err != nil {
+			return nil, err
+		}
+	case tx.provisioned != nil:
+		auth = v1alpha1.NewAuthentication(tx.provisioned.GetEnvironmentCredentials())
+	default:
+		return nil, nil
+	}
+	keyID := credentialKeyID(auth)
+	if keyID == "" {
+		return nil, errNoRevokeKeyID
+	}
+	keyIDs := []string{keyID}
+	if ob != nil {
+		if last := lastRotation(ob); last != nil && last.RevokedAt == nil && last.PreviousKeyID != "" {
+			keyIDs = append(keyIDs, last.PreviousKeyID)
+		}
+	}
+	return keyIDs, nil
+}
+
+// reportRevokeFailure records why access to the claim's brownfield bucket was not revoked.  The error is returned so
+// that the claim keeps its finalizer and is retried.
+func (r *ReconcileObjectBucketClaim) reportRevokeFailure(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, err error) error {
+	Log.Error(err, "not revoking bucket access")
+	setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionTrue, reasonRevokeFailed, err.Error())
+	r.recorder.Event(obc, corev1.EventTypeWarning, eventDeprovisionFailed, errorMessage(err))
+	r.updateClaimConditions(obc)
+	if ob != nil {
+		r.recorder.Event(ob, corev1.EventTypeWarning, eventDeprovisionFailed, errorMessage(err))
+		setObjectBucketCondition(ob, v1alpha1.ConditionProvisioned, corev1.ConditionTrue, reasonRevokeFailed, err.Error())
+		if err := r.writeObjectBucketStatus(ob); err != nil {
+			Log.Error(err, "failed to update object bucket conditions")
+		}
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package objectbucketclaim
+
+import (
+	"fmt"
+	"strings"
+
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
+)
+
+// Parameters that ask the plugin for optional features.  Either may be set by the StorageClass or, if allowed, by the
+// claim's additionalConfig.
+const (
+	paramQuota      = "quota"
+	paramVersioning = "versioning"
+)
+
+// requiredCapabilities returns the optional plugin features needed to provision a claim of class sc with the merged
+// params.
+func requiredCapabilities(sc *storagev1.StorageClass, params map[string]string) []plugin.Capability {
+	var required []plugin.Capability
+	if _, ok := brownfieldBucket(sc); ok {
+		required = append(required, plugin.CapabilityBrownfield)
+	}
+	// The bucket is only force emptied when it is deprovisioned, but a claim that cannot be released as its class
+	// says is better refused now.
+	if sc.Parameters[v1alpha1.StorageClassNonEmptyBucketPolicy] == string(v1alpha1.NonEmptyBucketForceEmpty) {
+		required = append(required, plugin.CapabilityForceEmpty)
+	}
+	if _, ok := params[paramQuota]; ok {
+		required = append(required, plugin.CapabilityQuota)
+	}
+	if v, ok := params[paramVersioning]; ok && !strings.EqualFold(v, "false") {
+		required = append(required, plugin.CapabilityVersioning)
+	}
+	return required
+}
+
+// unsupportedCapabilities returns an error naming the features required by the claim that the plugin lacks, or nil
+// if it supports them all.
+func unsupportedCapabilities(sc *storagev1.StorageClass, params map[string]string, p *pluginClient) error {
+	var names []string
+	for _, c := range requiredCapabilities(sc, params) {
+		if !p.supports(c) {
+			names = append(names, string(c))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("plugin %q for StorageClass %q does not support %s", sc.Provisioner, sc.Name, strings.Join(names, ", "))
+}
@@ -0,0 +1,262 @@
+package objectbucketclaim
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	. "github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucketclaim/requestLogger"
+)
+
+// errNoCredentialsRef is returned for OBs created before credentials were recorded, whose Secret cannot be regenerated.
+var errNoCredentialsRef = errors.New("object bucket does not reference a credentials secret")
+
+// claimForObjectBucket maps an OB to the claim it is bound to.  OBs are cluster scoped and so cannot carry an owner
+// reference to a claim; the claimRef serves instead.
+func claimForObjectBucket(o handler.MapObject) []reconcile.Request {
+	ob, ok := o.Object.(*v1alpha1.ObjectBucket)
+	if !ok || ob.Spec.ClaimRef == nil {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{
+		Namespace: ob.Spec.ClaimRef.Namespace,
+		Name:      ob.Spec.ClaimRef.Name,
+	}}}
+}
+
+// credentialsSecretRef returns where the credentials of the claim's OB are kept: the driver's namespace if it is known,
+// otherwise the claim's namespace.
+func (r *ReconcileObjectBucketClaim) credentialsSecretRef(obc *v1alpha1.ObjectBucketClaim) *corev1.SecretReference {
+	ns := r.credentialsNamespace
+	if ns == "" {
+		ns = obc.Namespace
+	}
+	return &corev1.SecretReference{Name: objectBucketNameForClaim(obc), Namespace: ns}
+}
+
+// createCredentialsSecret stores the credentials returned by the plugin in the Secret referenced by the OB.  The OB
+// owns the Secret so that it is garbage collected along with the OB.
+func (r *ReconcileObjectBucketClaim) createCredentialsSecret(ob *v1alpha1.ObjectBucket, auth *v1alpha1.Authentication) error {
+	ref := ob.Spec.CredentialsSecretRef
+	sec := new(corev1.Secret)
+	sec.SetName(ref.Name)
+	sec.SetNamespace(ref.Namespace)
+	// Data rather than StringData, as in updateCredentialsSecret, so that the Secret reads back as it was written.
+	sec.Data = make(map[string][]byte)
+	for k, v := range auth.ToMap() {
+		sec.Data[k] = []byte(v)
+	}
+	err := controllerutil.SetControllerReference(ob, sec, r.scheme)
+	if err != nil {
+		return err
+	}
+	Debug.Info("creating credentials secret", "Namespace", sec.Namespace, "Name", sec.Name)
+	err = r.client.Create(r.ctx, sec)
+	if !apierrs.IsAlreadyExists(err) {
+		return err
+	}
+	// A Secret left by an earlier attempt is owned by the OB; any other is not overwritten.
+	live := new(corev1.Secret)
+	if err := r.apiReader.Get(r.ctx, client.ObjectKey{Namespace: sec.Namespace, Name: sec.Name}, live); err != nil {
+		return err
+	}
+	return checkController(live, ob, "Secret")
+}
+
+// objectBucketCredentials reads the OB's credentials.  The Secret may live outside the watched namespace, so it is read
+// from the api server rather than the cache.
+func (r *ReconcileObjectBucketClaim) objectBucketCredentials(ob *v1alpha1.ObjectBucket) (*v1alpha1.Authentication, error) {
+	ref := ob.Spec.CredentialsSecretRef
+	if ref == nil {
+		return nil, errNoCredentialsRef
+	}
+	sec := new(corev1.Secret)
+	err := r.apiReader.Get(r.ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, sec)
+	if err != nil {
+		return nil, err
+	}
+	creds := make(map[string]string, len(sec.Data))
+	for k, v := range sec.Data {
+		creds[k] = string(v)
+	}
+	return v1alpha1.NewAuthentication(creds), nil
+}
+
+// syncBoundClaim compares the claim's Secret and ConfigMap against those generated from its OB and repairs any drift.
+// The outcome is reported through the InSync condition and childDriftTotal.  Once the children are in sync, the
+// claim's credentials are rotated if a rotation is due, and the time until they are next due is returned.  A claim
+// whose OB no longer exists is left alone; there is nothing to regenerate the children from.  An OB deleted under the
+// claim is reported but still served from, since its finalizer keeps it until the claim is deleted.  Children, or an
+// OB, that do not belong to the claim are reported and left untouched.
+func (r *ReconcileObjectBucketClaim) syncBoundClaim(obc *v1alpha1.ObjectBucketClaim, sc *storagev1.StorageClass, p *pluginClient) (time.Duration, error) {
+	ob, err := r.getBoundObjectBucket(obc)
+	if isNotOwned(err) {
+		r.reportDrift(obc, nil, err)
+		return 0, nil
+	}
+	if err != nil || ob == nil {
+		return 0, err
+	}
+	if ob.DeletionTimestamp != nil {
+		r.reportObjectBucketDeleting(obc, ob)
+	}
+
+	var drifted []string
+	record := func(kind, drift string) {
+		if drift == "" {
+			return
+		}
+		childDriftTotal.WithLabelValues(kind, drift).Inc()
+		drifted = append(drifted, fmt.Sprintf("%s %q was %s", kind, childResourceName(obc.Name), drift))
+	}
+
+	drift, err := r.syncChildSecret(obc, ob)
+	record("Secret", drift)
+	if errors.Is(err, errNoCredentialsRef) {
+		Log.Info("cannot compare secret", "reason", err.Error(), "ObjectBucket", ob.Name)
+	} else if err != nil {
+		setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionFalse, reasonSecretFailed, err.Error())
+		r.reportDrift(obc, drifted, err)
+		return 0, ignoreNotOwned(err)
+	} else if drift != "" {
+		setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionTrue, reasonSecretCreated, "")
+		r.recorder.Eventf(obc, corev1.EventTypeNormal, eventCredentialsRestored, "credentials restored to Secret %q", childResourceName(obc.Name))
+	}
+
+	drift, err = r.syncChildConfigMap(obc, ob)
+	record("ConfigMap", drift)
+	if err != nil {
+		setClaimCondition(obc, v1alpha1.ConditionConfigReady, corev1.ConditionFalse, reasonConfigMapFailed, err.Error())
+		r.reportDrift(obc, drifted, err)
+		return 0, ignoreNotOwned(err)
+	} else if drift != "" {
+		setClaimCondition(obc, v1alpha1.ConditionConfigReady, corev1.ConditionTrue, reasonConfigMapCreated, "")
+		r.recorder.Eventf(obc, corev1.EventTypeNormal, eventConfigRestored, "connection data restored to ConfigMap %q", childResourceName(obc.Name))
+	}
+
+	r.reportDrift(obc, drifted, nil)
+	return r.syncCredentials(obc, ob, sc, p)
+}
+
+// reportObjectBucketDeleting sets the ObjectBucketDeleting condition of a claim whose OB was deleted.  Deletion cannot
+// be undone, so the condition stays until the claim is deleted.
+func (r *ReconcileObjectBucketClaim) reportObjectBucketDeleting(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket) {
+	if v1alpha1.FindCondition(obc.Status.Conditions, v1alpha1.ConditionObjectBucketDeleting) != nil {
+		return
+	}
+	msg := fmt.Sprintf("ObjectBucket %q was deleted and is kept until the claim is deleted", ob.Name)
+	setClaimCondition(obc, v1alpha1.ConditionObjectBucketDeleting, corev1.ConditionTrue, reasonDeletionBlocked, msg)
+	r.updateClaimConditions(obc)
+}
+
+// reportDrift sets the InSync condition from the drift found by syncBoundClaim and the error, if any, that stopped its
+// repair.  Status is only written when it changed, since every claim is resynced periodically.
+func (r *ReconcileObjectBucketClaim) reportDrift(obc *v1alpha1.ObjectBucketClaim, drifted []string, repairErr error) {
+	before := obc.Status.DeepCopy()
+	switch {
+	case repairErr != nil:
+		msg := repairErr.Error()
+		if len(drifted) > 0 {
+			msg = fmt.Sprintf("%s; repair failed: %v", strings.Join(drifted, ", "), repairErr)
+		}
+		setClaimCondition(obc, v1alpha1.ConditionInSync, corev1.ConditionFalse, reasonDriftDetected, msg)
+	case len(drifted) > 0:
+		setClaimCondition(obc, v1alpha1.ConditionInSync, corev1.ConditionTrue, reasonDriftRepaired, strings.Join(drifted, ", "))
+	default:
+		setClaimCondition(obc, v1alpha1.ConditionInSync, corev1.ConditionTrue, reasonChildrenInSync, "")
+	}
+	if !reflect.DeepEqual(before, &obc.Status) {
+		r.updateClaimConditions(obc)
+	}
+}
+
+// syncChildSecret creates the claim's Secret if it is missing, or resets its data if it differs from the Secret
+// generated from the OB's credentials.  It returns the kind of drift found, if any.
+func (r *ReconcileObjectBucketClaim) syncChildSecret(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket) (string, error) {
+	auth, err := r.objectBucketCredentials(ob)
+	if err != nil {
+		return "", err
+	}
+	expected, err := generateSecret(obc, ob, auth)
+	if err != nil {
+		return "", err
+	}
+	live := new(corev1.Secret)
+	err = r.client.Get(r.ctx, client.ObjectKey{Namespace: expected.Namespace, Name: expected.Name}, live)
+	if apierrs.IsNotFound(err) {
+		Debug.Info("restoring missing child secret", "Namespace", expected.Namespace, "Name", expected.Name)
+		_, err = r.createChildSecret(obc, ob, auth)
+		return driftMissing, err
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := checkController(live, obc, "Secret"); err != nil {
+		return "", err
+	}
+
+	// Secrets are written with StringData, which the api server converts to Data.
+	data := make(map[string][]byte, len(expected.StringData))
+	for k, v := range expected.StringData {
+		data[k] = []byte(v)
+	}
+	if sameData(live.Data, data) {
+		return "", nil
+	}
+	Debug.Info("restoring modified child secret", "Namespace", live.Namespace, "Name", live.Name)
+	return driftModified, r.patchObject(live, func() error {
+		live.Data = data
+		return controllerutil.SetControllerReference(obc, live, r.scheme)
+	})
+}
+
+// syncChildConfigMap creates the claim's ConfigMap if it is missing, or resets its data if it differs from the
+// ConfigMap generated from the OB.  It returns the kind of drift found, if any.
+func (r *ReconcileObjectBucketClaim) syncChildConfigMap(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket) (string, error) {
+	expected, err := generateConfigMap(obc, ob)
+	if err != nil {
+		return "", err
+	}
+	live := new(corev1.ConfigMap)
+	err = r.client.Get(r.ctx, client.ObjectKey{Namespace: expected.Namespace, Name: expected.Name}, live)
+	if apierrs.IsNotFound(err) {
+		Debug.Info("restoring missing child config map", "Namespace", expected.Namespace, "Name", expected.Name)
+		_, err = r.createChildConfigMap(obc, ob)
+		return driftMissing, err
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := checkController(live, obc, "ConfigMap"); err != nil {
+		return "", err
+	}
+
+	if sameData(live.Data, expected.Data) {
+		return "", nil
+	}
+	Debug.Info("restoring modified child config map", "Namespace", live.Namespace, "Name", live.Name)
+	return driftModified, r.patchObject(live, func() error {
+		live.Data = expected.Data
+		return controllerutil.SetControllerReference(obc, live, r.scheme)
+	})
+}
+
+// sameData compares Secret or ConfigMap data, treating nil and empty as equal since the api server does not distinguish
+// between them.
+func sameData(live, expected interface{}) bool {
+	if reflect.ValueOf(live).Len() == 0 && reflect.ValueOf(expected).Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(live, expected)
+}
@@ -0,0 +1,83 @@
+package objectbucketclaim
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+)
+
+// Condition reasons set by the reconciler.
+const (
+	reasonStorageClassNotFound  = "StorageClassNotFound"
+	reasonInvalidBucketName     = "InvalidBucketName"
+	reasonInvalidConfig         = "InvalidAdditionalConfig"
+	reasonBucketProvisioned     = "BucketProvisioned"
+	reasonAccessGranted         = "AccessGranted"
+	reasonRevokeFailed          = "RevokeAccessFailed"
+	reasonProvisionFailed       = "ProvisionFailed"
+	reasonDeprovisionFailed     = "DeprovisionFailed"
+	reasonBucketDeleted         = "BucketDeleted"
+	reasonBucketAlreadyDeleted  = "BucketAlreadyDeleted"
+	reasonBucketNotEmpty        = "BucketNotEmpty"
+	reasonPartiallyDeleted      = "PartiallyDeleted"
+	reasonInvalidReclaimPolicy  = "InvalidReclaimPolicy"
+	reasonRolledBack            = "RolledBack"
+	reasonSecretCreated         = "SecretCreated"
+	reasonSecretFailed          = "SecretCreateFailed"
+	reasonConfigMapCreated      = "ConfigMapCreated"
+	reasonConfigMapFailed       = "ConfigMapCreateFailed"
+	reasonPluginResponded       = "PluginResponded"
+	reasonPluginUnreachable     = "PluginUnreachable"
+	reasonPluginUnavailable     = "PluginUnavailable"
+	reasonChildrenInSync        = "ChildrenInSync"
+	reasonDriftRepaired         = "DriftRepaired"
+	reasonDriftDetected         = "DriftDetected"
+	reasonCredentialsRotated    = "CredentialsRotated"
+	reasonRotationFailed        = "RotationFailed"
+	reasonCredentialsExpired    = "CredentialsExpired"
+	reasonLayoutConflict        = "LayoutConflict"
+	reasonUnsupportedCapability = "UnsupportedCapability"
+	reasonDeletionBlocked       = "DeletionBlocked"
+)
+
+func setClaimCondition(obc *v1alpha1.ObjectBucketClaim, t v1alpha1.ConditionType, s corev1.ConditionStatus, reason, msg string) {
+	v1alpha1.SetCondition(&obc.Status.Conditions, v1alpha1.Condition{
+		Type:               t,
+		Status:             s,
+		ObservedGeneration: obc.Generation,
+		Reason:             reason,
+		Message:            msg,
+	})
+}
+
+func setObjectBucketCondition(ob *v1alpha1.ObjectBucket, t v1alpha1.ConditionType, s corev1.ConditionStatus, reason, msg string) {
+	v1alpha1.SetCondition(&ob.Status.Conditions, v1alpha1.Condition{
+		Type:               t,
+		Status:             s,
+		ObservedGeneration: ob.Generation,
+		Reason:             reason,
+		Message:            msg,
+	})
+}
+
+// pluginReachableCondition derives the PluginReachable condition from the error of a plugin call.  Any response from
+// the plugin, including an error status, means the plugin was reached.
+func pluginReachableCondition(err error) (corev1.ConditionStatus, string, string) {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return corev1.ConditionFalse, reasonPluginUnreachable, err.Error()
+	}
+	return corev1.ConditionTrue, reasonPluginResponded, ""
+}
+
+func setClaimPluginReachable(obc *v1alpha1.ObjectBucketClaim, err error) {
+	s, reason, msg := pluginReachableCondition(err)
+	setClaimCondition(obc, v1alpha1.ConditionPluginReachable, s, reason, msg)
+}
+
+func setObjectBucketPluginReachable(ob *v1alpha1.ObjectBucket, err error) {
+	s, reason, msg := pluginReachableCondition(err)
+	setObjectBucketCondition(ob, v1alpha1.ConditionPluginReachable, s, reason, msg)
+}
@@ -0,0 +1,103 @@
+package objectbucketclaim
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	. "github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucketclaim/requestLogger"
+	"github.com/yard-turkey/cosi-prototype-interface/cosi"
+)
+
+// The DeprovisionResponse message carries no fields, so plugins report how deprovisioning went through the gRPC status
+// of the call:
+//
+//	OK                  the bucket was deleted
+//	NotFound            the bucket was already gone, which counts as success
+//	FailedPrecondition  the bucket still holds objects and was left in place
+//	Aborted             some of the bucket's objects were deleted before the plugin gave up; the call is retried
+//
+// Any other code is a failure of the call itself.
+//
+// forceEmptyMetadataKey is sent when the StorageClass's v1alpha1.NonEmptyBucketForceEmpty policy retries a bucket the
+// plugin reported was not empty, and only to plugins reporting plugin.CapabilityForceEmpty.  A plugin receiving it must
+// delete the bucket's objects before the bucket.
+const (
+	forceEmptyMetadataKey   = "cosi-force-empty"
+	forceEmptyMetadataValue = "true"
+)
+
+func forceEmptyContext(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, forceEmptyMetadataKey, forceEmptyMetadataValue)
+}
+
+// nonEmptyBucketPolicy returns the StorageClass's v1alpha1.StorageClassNonEmptyBucketPolicy, defaulting to
+// v1alpha1.NonEmptyBucketFail.
+func nonEmptyBucketPolicy(sc *storagev1.StorageClass) (v1alpha1.NonEmptyBucketPolicy, error) {
+	policy := v1alpha1.NonEmptyBucketPolicy(sc.Parameters[v1alpha1.StorageClassNonEmptyBucketPolicy])
+	switch policy {
+	case "":
+		return v1alpha1.NonEmptyBucketFail, nil
+	case v1alpha1.NonEmptyBucketFail, v1alpha1.NonEmptyBucketForceEmpty, v1alpha1.NonEmptyBucketRetain:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unsupported %s %q", v1alpha1.StorageClassNonEmptyBucketPolicy, policy)
+}
+
+// deprovisionReason classifies the error returned by Deprovision as a condition reason.
+func deprovisionReason(err error) string {
+	switch status.Code(err) {
+	case codes.OK:
+		return reasonBucketDeleted
+	case codes.NotFound:
+		return reasonBucketAlreadyDeleted
+	case codes.FailedPrecondition:
+		return reasonBucketNotEmpty
+	case codes.Aborted:
+		return reasonPartiallyDeleted
+	}
+	return reasonDeprovisionFailed
+}
+
+// deprovision calls the plugin's Deprovision for bucket and returns the outcome as a condition reason.  A bucket that
+// was already gone is not an error.
+func (r *ReconcileObjectBucketClaim) deprovision(ctx context.Context, p *pluginClient, bucket string) (string, error) {
+	rpcCtx, cancel := r.rpcContext(ctx)
+	defer cancel()
+	_, err := p.provisioner.Deprovision(rpcCtx, &cosi.DeprovisionRequest{
+		BucketName: bucket,
+	})
+	reason := deprovisionReason(err)
+	if reason == reasonBucketAlreadyDeleted {
+		Log.Info("bucket was already deleted", "BucketName", bucket)
+		err = nil
+	}
+	return reason, err
+}
+
+// releasedBucketName returns the name of the bucket to release for the claim.  The OB, or the claim's status if binding
+// failed part way, records the name the bucket was actually provisioned under, which the plugin may have changed.
+func (r *ReconcileObjectBucketClaim) releasedBucketName(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket) string {
+	if ob != nil && ob.Spec.Connection != nil && ob.Spec.Endpoint != nil && ob.Spec.Endpoint.BucketName != "" {
+		return ob.Spec.Endpoint.BucketName
+	}
+	if obc.Status.ProvisionedBucketName != "" {
+		return obc.Status.ProvisionedBucketName
+	}
+	return obc.Spec.BucketName
+}
+
+// reportDeprovisioned records on the OB that its bucket is gone, in case deleting the OB fails and leaves it behind.
+func (r *ReconcileObjectBucketClaim) reportDeprovisioned(ob *v1alpha1.ObjectBucket, reason, msg string) {
+	setObjectBucketPluginReachable(ob, nil)
+	setObjectBucketCondition(ob, v1alpha1.ConditionProvisioned, corev1.ConditionFalse, reason, msg)
+	if err := r.writeObjectBucketStatus(ob); err != nil {
+		Log.Error(err, "failed to update object bucket conditions")
+	}
+}
@@ -0,0 +1,56 @@
+package objectbucketclaim
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	. "github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucketclaim/requestLogger"
+)
+
+const (
+	// defaultResyncPeriod is how often a bound claim's Secret and ConfigMap are compared against its OB.  Watches catch
+	// most changes as they happen; the resync repairs any they missed.
+	defaultResyncPeriod = 5 * time.Minute
+	// resyncPeriodEnv overrides defaultResyncPeriod with a duration such as "10m".  A zero duration disables the resync;
+	// claims are still requeued when their credentials are due to be rotated or revoked.
+	resyncPeriodEnv = "COSI_RESYNC_PERIOD"
+)
+
+// Drift kinds, reported as the "drift" label of childDriftTotal.
+const (
+	driftMissing  = "missing"
+	driftModified = "modified"
+)
+
+// childDriftTotal counts the child resources found to differ from their OB, whether or not the repair succeeded.
+var childDriftTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cosi_claim_child_drift_total",
+	Help: "Number of claim Secrets and ConfigMaps found missing or modified.",
+}, []string{"resource", "drift"})
+
+func init() {
+	// Registered with the controller-runtime registry so that the manager's metrics endpoint serves it.
+	metrics.Registry.MustRegister(childDriftTotal)
+}
+
+// resyncPeriod returns the period set by resyncPeriodEnv, falling back to defaultResyncPeriod if it is unset or invalid.
+func resyncPeriod() time.Duration {
+	d := durationFromEnv(resyncPeriodEnv, defaultResyncPeriod)
+	if d == 0 {
+		Log.Info("periodic resync disabled, drift missed by watches is not repaired", "env", resyncPeriodEnv)
+	}
+	return d
+}
+
+// earliest returns the shortest of the positive durations, or zero if there are none.
+func earliest(durations ...time.Duration) time.Duration {
+	var min time.Duration
+	for _, d := range durations {
+		if d > 0 && (min == 0 || d < min) {
+			min = d
+		}
+	}
+	return min
+}
@@ -0,0 +1,43 @@
+package objectbucketclaim
+
+import (
+	"google.golang.org/grpc/status"
+)
+
+// Event reasons recorded against claims and object buckets.  Together they let `kubectl describe` tell the story of a
+// claim without access to the driver's logs.
+const (
+	eventProvisioningStarted   = "ProvisioningStarted"
+	eventProvisioningFailed    = "ProvisioningFailed"
+	eventBucketCreated         = "BucketCreated"
+	eventAccessGranted         = "AccessGranted"
+	eventAccessRevoked         = "AccessRevoked"
+	eventBound                 = "Bound"
+	eventCredentialsPublished  = "CredentialsPublished"
+	eventConfigPublished       = "ConfigPublished"
+	eventCredentialsRestored   = "CredentialsRestored"
+	eventConfigRestored        = "ConfigRestored"
+	eventCredentialsRotated    = "CredentialsRotated"
+	eventCredentialsRevoked    = "CredentialsRevoked"
+	eventRotationFailed        = "RotationFailed"
+	eventCredentialsExpired    = "CredentialsExpired"
+	eventRollbackFailed        = "RollbackFailed"
+	eventRolledBack            = "RolledBack"
+	eventDeprovisioningStarted = "DeprovisioningStarted"
+	eventDeprovisioned         = "Deprovisioned"
+	eventDeprovisionFailed     = "DeprovisionFailed"
+	eventRetained              = "Retained"
+	eventReleased              = "Released"
+)
+
+// eventRecorderName is the component name events are reported under.
+const eventRecorderName = "cosi-prototype-driver"
+
+// errorMessage returns the message of a gRPC status error without the code prefix, so that the plugin's own explanation
+// is what users see.  Other errors are returned whole.
+func errorMessage(err error) string {
+	if s, ok := status.FromError(err); ok {
+		return s.Message()
+	}
+	return err.Error()
+}
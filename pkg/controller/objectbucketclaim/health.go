@@ -0,0 +1,89 @@
+package objectbucketclaim
+
+import (
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	. "github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucketclaim/requestLogger"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
+	"github.com/yard-turkey/cosi-prototype-interface/cosi"
+)
+
+// pluginClient is a plugin the reconciler routes claims to.
+type pluginClient struct {
+	provisioner cosi.ProvisionerClient
+	// health reports whether the plugin can currently serve calls.
+	health healthChecker
+	// capabilities are the optional features the plugin supports.
+	capabilities plugin.Capabilities
+	// access grants and revokes access to existing buckets, or is nil if the plugin cannot.
+	access accessClient
+}
+
+// supports reports whether the plugin supports capability.  Brownfield buckets and credential rotation also need the
+// plugin's accessClient.
+func (p *pluginClient) supports(capability plugin.Capability) bool {
+	switch capability {
+	case plugin.CapabilityBrownfield, plugin.CapabilityCredentialRotation:
+		if p.access == nil {
+			return false
+		}
+	}
+	return p.capabilities.Has(capability)
+}
+
+// pluginSource finds the plugin serving a provisioner.
+type pluginSource interface {
+	lookup(provisioner string) (*pluginClient, bool)
+}
+
+// pluginMap is a fixed set of plugins keyed by provisioner name.
+type pluginMap map[string]*pluginClient
+
+func (m pluginMap) lookup(provisioner string) (*pluginClient, bool) {
+	p, ok := m[provisioner]
+	return p, ok
+}
+
+// registrySource finds plugins in a plugin.Registry, which gains the plugins reached after startup.
+type registrySource struct {
+	registry *plugin.Registry
+}
+
+func (s registrySource) lookup(provisioner string) (*pluginClient, bool) {
+	p, ok := s.registry.Get(provisioner)
+	if !ok {
+		return nil, false
+	}
+	// No plugin can be granted an accessClient yet; see accessClient.
+	return &pluginClient{provisioner: p.Client, health: p, capabilities: p.Capabilities()}, true
+}
+
+// healthChecker reports the health of a plugin.  It is implemented by plugin.Plugin and plugin.Prober.
+type healthChecker interface {
+	// Healthy returns nil if the plugin passed its last health check.
+	Healthy() error
+	// Interval returns the period between health checks.
+	Interval() time.Duration
+}
+
+// needsPlugin reports whether syncing obc calls the plugin.  Bound claims only have their children synced, which the
+// driver does alone; provisioning and deprovisioning go through the plugin.
+func needsPlugin(obc *v1alpha1.ObjectBucketClaim) bool {
+	return isDeletionEvent(obc) || (!isFailed(obc) && pendingProvisioning(obc))
+}
+
+// holdForPlugin defers the claim until the plugin is healthy again, rather than spending its retry budget on calls
+// that cannot succeed.  The claim is marked with the reason and checked again after the next health check.
+func (r *ReconcileObjectBucketClaim) holdForPlugin(obc *v1alpha1.ObjectBucketClaim, p *pluginClient, healthErr error) error {
+	Log.Info("plugin unhealthy, holding claim", "reason", healthErr.Error())
+	before := obc.Status.DeepCopy()
+	setClaimCondition(obc, v1alpha1.ConditionPluginReachable, corev1.ConditionFalse, reasonPluginUnavailable, healthErr.Error())
+	if !reflect.DeepEqual(before, &obc.Status) {
+		r.updateClaimConditions(obc)
+	}
+	return &requeueAfterError{err: healthErr, after: p.health.Interval()}
+}
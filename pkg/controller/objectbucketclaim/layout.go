@@ -0,0 +1,276 @@
+package objectbucketclaim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yard-turkey/cosi-prototype-interface/cosi"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+)
+
+// rcloneRemote is the name of the remote rendered into rclone config files.
+const rcloneRemote = "cosi"
+
+// layoutError reports that a claim's children cannot be generated with its connection layout.  Retrying does not
+// change the outcome, so provisioning treats it as terminal.
+type layoutError struct {
+	msg string
+}
+
+func (e *layoutError) Error() string {
+	return e.msg
+}
+
+// connectionLayoutFor resolves the layout of the claim's Secret and ConfigMap from the StorageClass parameters and the
+// claim's own layout, which takes precedence.  It returns nil for the default layout.
+func connectionLayoutFor(sc *storagev1.StorageClass, obc *v1alpha1.ObjectBucketClaim) (*v1alpha1.ConnectionLayout, error) {
+	layout := &v1alpha1.ConnectionLayout{Keys: make(map[string]string)}
+	for _, pair := range strings.Split(sc.Parameters[v1alpha1.StorageClassConnectionKeys], ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid %s: %q is not a default=name pair", v1alpha1.StorageClassConnectionKeys, pair)
+		}
+		layout.Keys[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	for _, f := range strings.Split(sc.Parameters[v1alpha1.StorageClassConnectionFormats], ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			layout.Formats = append(layout.Formats, v1alpha1.ConnectionFormat(f))
+		}
+	}
+	if claim := obc.Spec.ConnectionLayout; claim != nil {
+		for k, v := range claim.Keys {
+			layout.Keys[k] = v
+		}
+		if len(claim.Formats) > 0 {
+			layout.Formats = append([]v1alpha1.ConnectionFormat(nil), claim.Formats...)
+		}
+	}
+
+	if len(layout.Keys) == 0 && len(layout.Formats) == 0 {
+		return nil, nil
+	}
+	if len(layout.Keys) == 0 {
+		layout.Keys = nil
+	}
+	if err := v1alpha1.ValidateConnectionLayout(layout); err != nil {
+		return nil, err
+	}
+	return layout, nil
+}
+
+// checkConnectionLayout renders the children of a claim provisioned with resp, so that a layout the response cannot
+// fill is refused before the claim is bound.
+func checkConnectionLayout(obc *v1alpha1.ObjectBucketClaim, resp *cosi.ProvisionResponse, layout *v1alpha1.ConnectionLayout) error {
+	ob := generateObjectBucket(obc, resp, nil)
+	ob.Spec.ConnectionLayout = layout
+	if _, err := configMapData(ob); err != nil {
+		return err
+	}
+	_, err := secretData(ob, v1alpha1.NewAuthentication(resp.GetEnvironmentCredentials()))
+	return err
+}
+
+// keyWriter collects the data of a Secret or ConfigMap, recording the keys written more than once.
+type keyWriter struct {
+	data       map[string]string
+	collisions []string
+}
+
+func newKeyWriter() *keyWriter {
+	return &keyWriter{data: make(map[string]string)}
+}
+
+func (w *keyWriter) put(key, value string) {
+	if _, ok := w.data[key]; ok {
+		w.collisions = append(w.collisions, key)
+		return
+	}
+	w.data[key] = value
+}
+
+func (w *keyWriter) result(kind string) (map[string]string, error) {
+	if len(w.collisions) > 0 {
+		sort.Strings(w.collisions)
+		return nil, &layoutError{fmt.Sprintf("the plugin's connection data collides with %s keys of the connection layout: %s",
+			kind, strings.Join(w.collisions, ", "))}
+	}
+	return w.data, nil
+}
+
+// configMapData renders the claim's ConfigMap data from the OB.  The plugin's connection data is written under its own
+// keys, which must not collide with those of the layout.
+func configMapData(ob *v1alpha1.ObjectBucket) (map[string]string, error) {
+	layout := ob.Spec.ConnectionLayout
+	ep := ob.Spec.Endpoint
+	w := newKeyWriter()
+	w.put(layout.Key(v1alpha1.BucketEndpointKey), ep.BucketHost)
+	w.put(layout.Key(v1alpha1.BucketRegionKey), ep.Region)
+	w.put(layout.Key(v1alpha1.BucketNameKey), ep.BucketName)
+	if hasFormat(layout, v1alpha1.ConnectionFormatAWSConfig) {
+		w.put(layout.Key(v1alpha1.ConnectionFormatAWSConfig.Key()), renderAWSConfig(ep))
+	}
+	keys := make([]string, 0, len(ob.Spec.AdditionalState))
+	for k := range ob.Spec.AdditionalState {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		w.put(k, ob.Spec.AdditionalState[k])
+	}
+	return w.result("ConfigMap")
+}
+
+// secretData renders the claim's Secret data from the OB and its credentials.  Credential keys the plugin returned
+// that are not of a known type are written under their own keys, which must not collide with those of the layout.
+func secretData(ob *v1alpha1.ObjectBucket, auth *v1alpha1.Authentication) (map[string]string, error) {
+	layout := ob.Spec.ConnectionLayout
+	creds := auth.ToMap()
+	keys := make([]string, 0, len(creds))
+	for k := range creds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w := newKeyWriter()
+	for _, k := range keys {
+		w.put(layout.Key(k), creds[k])
+	}
+	if layout != nil {
+		for _, f := range layout.Formats {
+			if !f.InSecret() {
+				continue
+			}
+			v, err := renderSecretFormat(f, ob, auth)
+			if err != nil {
+				return nil, err
+			}
+			w.put(layout.Key(f.Key()), v)
+		}
+	}
+	return w.result("Secret")
+}
+
+func hasFormat(layout *v1alpha1.ConnectionLayout, f v1alpha1.ConnectionFormat) bool {
+	if layout == nil {
+		return false
+	}
+	for _, lf := range layout.Formats {
+		if lf == f {
+			return true
+		}
+	}
+	return false
+}
+
+func renderSecretFormat(f v1alpha1.ConnectionFormat, ob *v1alpha1.ObjectBucket, auth *v1alpha1.Authentication) (string, error) {
+	switch f {
+	case v1alpha1.ConnectionFormatAWSCredentials:
+		return renderAWSCredentials(auth)
+	case v1alpha1.ConnectionFormatRclone:
+		return renderRclone(ob.Spec.Endpoint, auth)
+	case v1alpha1.ConnectionFormatJSON:
+		return renderJSON(ob, auth)
+	}
+	return "", &layoutError{fmt.Sprintf("unsupported format %q", f)}
+}
+
+// iniSection writes an INI section, leaving out the keys with empty values.
+func iniSection(b *strings.Builder, name string, kvs ...string) {
+	fmt.Fprintf(b, "[%s]\n", name)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if kvs[i+1] != "" {
+			fmt.Fprintf(b, "%s = %s\n", kvs[i], kvs[i+1])
+		}
+	}
+}
+
+// s3KeyPair returns the S3 style key pair of auth and its session token, if any.
+func s3KeyPair(auth *v1alpha1.Authentication) (id, secret, token string, ok bool) {
+	switch {
+	case auth.AccessKeys != nil:
+		return auth.AccessKeys.AccessKeyID, auth.AccessKeys.SecretAccessKey, "", true
+	case auth.SessionCredentials != nil:
+		s := auth.SessionCredentials
+		return s.AccessKeyID, s.SecretAccessKey, s.SessionToken, true
+	}
+	return "", "", "", false
+}
+
+func renderAWSCredentials(auth *v1alpha1.Authentication) (string, error) {
+	id, secret, token, ok := s3KeyPair(auth)
+	if !ok {
+		return "", &layoutError{fmt.Sprintf("format %q needs S3 access keys, which the plugin did not return", v1alpha1.ConnectionFormatAWSCredentials)}
+	}
+	b := new(strings.Builder)
+	iniSection(b, "default",
+		"aws_access_key_id", id,
+		"aws_secret_access_key", secret,
+		"aws_session_token", token)
+	return b.String(), nil
+}
+
+func renderAWSConfig(ep *v1alpha1.Endpoint) string {
+	b := new(strings.Builder)
+	iniSection(b, "default",
+		"region", ep.Region,
+		"endpoint_url", ep.BucketHost)
+	return b.String()
+}
+
+func renderRclone(ep *v1alpha1.Endpoint, auth *v1alpha1.Authentication) (string, error) {
+	b := new(strings.Builder)
+	if id, secret, token, ok := s3KeyPair(auth); ok {
+		iniSection(b, rcloneRemote,
+			"type", "s3",
+			"provider", "Other",
+			"access_key_id", id,
+			"secret_access_key", secret,
+			"session_token", token,
+			"endpoint", ep.BucketHost,
+			"region", ep.Region)
+		return b.String(), nil
+	}
+	if auth.ServiceAccountKey != nil {
+		// rclone reads the key inline, so it must fit on a single line.
+		key := new(bytes.Buffer)
+		if err := json.Compact(key, []byte(auth.ServiceAccountKey.JSON)); err != nil {
+			return "", &layoutError{fmt.Sprintf("service account key is not valid JSON: %v", err)}
+		}
+		iniSection(b, rcloneRemote,
+			"type", "google cloud storage",
+			"service_account_credentials", key.String())
+		return b.String(), nil
+	}
+	return "", &layoutError{fmt.Sprintf("format %q needs S3 access keys or a GCS service account key, which the plugin did not return", v1alpha1.ConnectionFormatRclone)}
+}
+
+// connectionDocument is the JSON rendering of a bucket's connection.
+type connectionDocument struct {
+	BucketName  string            `json:"bucketName"`
+	Endpoint    string            `json:"endpoint"`
+	Region      string            `json:"region,omitempty"`
+	Data        map[string]string `json:"data,omitempty"`
+	Credentials map[string]string `json:"credentials"`
+}
+
+func renderJSON(ob *v1alpha1.ObjectBucket, auth *v1alpha1.Authentication) (string, error) {
+	ep := ob.Spec.Endpoint
+	doc, err := json.MarshalIndent(connectionDocument{
+		BucketName:  ep.BucketName,
+		Endpoint:    ep.BucketHost,
+		Region:      ep.Region,
+		Data:        ob.Spec.AdditionalState,
+		Credentials: auth.ToMap(),
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(doc), nil
+}
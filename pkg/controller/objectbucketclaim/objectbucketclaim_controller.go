@@ -2,12 +2,24 @@ package objectbucketclaim
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -18,30 +30,37 @@ import (
 
 	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
 	. "github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucketclaim/requestLogger"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectutil"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
 	"github.com/yard-turkey/cosi-prototype-interface/cosi"
 )
 
 // Add creates a new ObjectBucketClaim Controller and adds it to the Manager. The Manager will set fields on the Controller
-// and Start it when the Manager is Started.
-func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+// and Start it when the Manager is Started.  Claims are routed to the plugin in registry named by their StorageClass's
+// provisioner.
+func Add(mgr manager.Manager, registry *plugin.Registry) error {
+	return add(mgr, newReconciler(mgr, registrySource{registry}))
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	ctx := context.Background()
-	resp, err := grpcClient.GetPluginName(ctx, &cosi.PluginNameRequest{})
+func newReconciler(mgr manager.Manager, plugins pluginSource) reconcile.Reconciler {
+	credentialsNamespace, err := k8sutil.GetOperatorNamespace()
 	if err != nil {
-		Log.Error(err, "cannot get plugin name")
-		panic(err)
+		Log.Info("driver namespace unknown, bucket credentials will be kept in claim namespaces", "reason", err.Error())
 	}
-	Debug.Info("setting plugin provisioner: " + resp.Name)
 
 	return &ReconcileObjectBucketClaim{
-		client:     mgr.GetClient(),
-		scheme:     mgr.GetScheme(),
-		pluginName: resp.Name,
-		ctx:        ctx,
+		client:               mgr.GetClient(),
+		apiReader:            mgr.GetAPIReader(),
+		recorder:             mgr.GetEventRecorderFor(eventRecorderName),
+		scheme:               mgr.GetScheme(),
+		plugins:              plugins,
+		ctx:                  context.Background(),
+		transactions:         newTransactionTracker(),
+		provisionRetryBudget: defaultProvisionRetryBudget,
+		credentialsNamespace: credentialsNamespace,
+		resyncPeriod:         resyncPeriod(),
+		rpcTimeout:           durationFromEnv(rpcTimeoutEnv, defaultRPCTimeout),
 	}
 }
 
@@ -59,10 +78,20 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
-	// Watch for changes to secondary resource Pods and requeue the owner ObjectBucketClaim
-	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestForOwner{
-		IsController: true,
-		OwnerType:    &v1alpha1.ObjectBucketClaim{},
+	// Watch for changes to the Secrets and ConfigMaps owned by claims so that they are restored if deleted or edited
+	for _, child := range []runtime.Object{&corev1.Secret{}, &corev1.ConfigMap{}} {
+		err = c.Watch(&source.Kind{Type: child}, &handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &v1alpha1.ObjectBucketClaim{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Watch for changes to ObjectBuckets and requeue the claim they are bound to
+	err = c.Watch(&source.Kind{Type: &v1alpha1.ObjectBucket{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(claimForObjectBucket),
 	})
 	if err != nil {
 		return err
@@ -78,13 +107,35 @@ var _ reconcile.Reconciler = &ReconcileObjectBucketClaim{}
 type ReconcileObjectBucketClaim struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client     client.Client
-	scheme     *runtime.Scheme
-	pluginName string
+	client client.Client
+	scheme *runtime.Scheme
+
+	// plugins finds the plugins serving claims by the provisioner name StorageClasses refer to them by.
+	plugins pluginSource
+
+	// apiReader reads directly from the api server.  It is used to refetch objects after a write conflict, when the
+	// cached copy is known to be stale.
+	apiReader client.Reader
+	// recorder publishes provisioning milestones as Events on claims and object buckets.
+	recorder record.EventRecorder
 
 	// ctx is the parent context of child timeout contexts used to regulate grpclient method
 	// calls under the Reconcile() call stack.
 	ctx context.Context
+
+	// transactions tracks in-progress provisioning per claim so that completed steps can be rolled back once
+	// provisionRetryBudget failed attempts have been made.
+	transactions         *transactionTracker
+	provisionRetryBudget int
+
+	// credentialsNamespace is where the Secrets holding each OB's credentials are kept.  If empty, they are kept in the
+	// claim's namespace.
+	credentialsNamespace string
+
+	// resyncPeriod is how often bound claims are requeued to detect drift in their children.  Zero disables the resync.
+	resyncPeriod time.Duration
+	// rpcTimeout bounds each call to the plugin.  Zero leaves calls unbounded.
+	rpcTimeout time.Duration
 }
 
 // Reconcile reads that state of the cluster for a ObjectBucketClaim object and makes changes based on the state read
@@ -110,38 +161,154 @@ func (r *ReconcileObjectBucketClaim) Reconcile(request reconcile.Request) (recon
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
-	err = r.syncClaim(instance)
+	next, err := r.syncClaim(instance)
+	var retry *requeueAfterError
+	if errors.As(err, &retry) {
+		Log.Error(retry.err, "sync failed, requeueing", "after", retry.after.String())
+		return reconcile.Result{RequeueAfter: retry.after}, nil
+	}
+	if err == nil && isBound(instance) {
+		if after := earliest(r.resyncPeriod, next); after > 0 {
+			return reconcile.Result{RequeueAfter: after}, nil
+		}
+	}
 
 	return reconcile.Result{}, err
 }
 
-func (r *ReconcileObjectBucketClaim) syncClaim(obc *v1alpha1.ObjectBucketClaim) error {
+// syncClaim returns, for a bound claim, how soon its credentials are next due to be rotated or revoked, or zero if
+// they are not.
+func (r *ReconcileObjectBucketClaim) syncClaim(obc *v1alpha1.ObjectBucketClaim) (time.Duration, error) {
 	Log.Info("syncing claim")
 	storageClassInstance, err := r.storageClassFromClaim(obc)
 	if err != nil {
-		return err
+		if apierrs.IsNotFound(err) {
+			setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionFalse, reasonStorageClassNotFound, err.Error())
+			r.updateClaimConditions(obc)
+		}
+		return 0, err
 	}
-	if r.isSupportedPlugin(storageClassInstance.Provisioner) {
+	var next time.Duration
+	if p, ok := r.pluginFor(storageClassInstance.Provisioner); ok {
+		if needsPlugin(obc) {
+			if err := p.health.Healthy(); err != nil {
+				return 0, r.holdForPlugin(obc, p, err)
+			}
+		}
 		if isDeletionEvent(obc) {
 			Debug.Info("processing deletion")
-			err = r.handleDeprovisionClaim(obc)
+			err = r.handleDeprovisionClaim(obc, storageClassInstance, p)
 		} else {
 			// Interruptions in provisioning may result in an actual state of the world where the OB was not set in the
 			// OBC but the secret and config map were created.  So we cannot short circuit syncClaim by checking
 			// this field earlier as deletions may still need to clean up artifacts.
-			if pendingProvisioning(obc) {
+			if isFailed(obc) {
+				Log.Info("obc provisioning failed, skipping")
+			} else if pendingProvisioning(obc) {
 				//By now, we should know that the OBC matches our plugin, lacks an OB, and thus requires provisioning
-				err = r.handleProvisionClaim(obc, storageClassInstance)
+				err = r.handleProvisionClaim(obc, storageClassInstance, p)
 			} else {
-				Log.Info("obc already fulfilled, skipping")
+				Debug.Info("obc already fulfilled, syncing children")
+				next, err = r.syncBoundClaim(obc, storageClassInstance, p)
 			}
 		}
 	}
 
-	return err
+	return next, err
+}
+
+func (r *ReconcileObjectBucketClaim) handleProvisionClaim(obc *v1alpha1.ObjectBucketClaim, sc *storagev1.StorageClass, p *pluginClient) error {
+	// An invalid bucket name request cannot be fixed by retrying, so the claim is failed and the error is not returned
+	// to the work queue.
+	validate := validateBucketName
+	if bucket, ok := brownfieldBucket(sc); ok {
+		validate = func(obc *v1alpha1.ObjectBucketClaim) error { return v1alpha1.ValidateBrownfieldClaim(obc, bucket) }
+	}
+	if err := validate(obc); err != nil {
+		Log.Error(err, "rejecting claim")
+		setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionFalse, reasonInvalidBucketName, err.Error())
+		r.recorder.Event(obc, corev1.EventTypeWarning, eventProvisioningFailed, err.Error())
+		return r.setClaimPhaseFailed(obc, err.Error())
+	}
+	params, err := mergeParameters(sc, obc)
+	if err != nil {
+		Log.Error(err, "rejecting claim")
+		setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionFalse, reasonInvalidConfig, err.Error())
+		r.recorder.Event(obc, corev1.EventTypeWarning, eventProvisioningFailed, err.Error())
+		return r.setClaimPhaseFailed(obc, err.Error())
+	}
+	layout, err := connectionLayoutFor(sc, obc)
+	if err != nil {
+		Log.Error(err, "rejecting claim")
+		setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionFalse, reasonInvalidConfig, err.Error())
+		r.recorder.Event(obc, corev1.EventTypeWarning, eventProvisioningFailed, err.Error())
+		return r.setClaimPhaseFailed(obc, err.Error())
+	}
+	// Features the plugin lacks would only fail inside the RPC, so the claim is failed before the plugin is called.
+	if err := unsupportedCapabilities(sc, params, p); err != nil {
+		Log.Error(err, "rejecting claim")
+		setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionFalse, reasonUnsupportedCapability, err.Error())
+		r.recorder.Event(obc, corev1.EventTypeWarning, eventProvisioningFailed, err.Error())
+		return r.setClaimPhaseFailed(obc, err.Error())
+	}
+
+	tx := r.transactions.get(obc.UID)
+	_, tx.brownfield = brownfieldBucket(sc)
+	if tx.attempts == 0 && tx.provisioned == nil {
+		r.recorder.Eventf(obc, corev1.EventTypeNormal, eventProvisioningStarted, "provisioning bucket with StorageClass %q", sc.Name)
+	}
+	err = r.provisionClaim(obc, sc, params, layout, tx, p)
+	if err == nil {
+		r.transactions.forget(obc.UID)
+		Debug.Info("provisioning succeeded")
+		return nil
+	}
+
+	tx.attempts++
+	if isUnavailable(err) {
+		Log.Error(err, "plugin unavailable, will retry", "attempts", tx.attempts)
+		r.recorder.Eventf(obc, corev1.EventTypeWarning, eventProvisioningFailed, "plugin unavailable: %s", errorMessage(err))
+		r.updateClaimConditions(obc)
+		return requeueAfter(err, tx.attempts)
+	}
+	tx.failures++
+	r.recorder.Eventf(obc, corev1.EventTypeWarning, eventProvisioningFailed, "attempt %d of %d: %s", tx.failures, r.provisionRetryBudget, errorMessage(err))
+	// A plugin that rejects the request outright will reject it again, so the remaining budget is not spent on it.
+	if tx.failures < r.provisionRetryBudget && !isTerminal(err) {
+		Log.Error(err, "provisioning failed, will retry", "attempt", tx.failures, "budget", r.provisionRetryBudget)
+		r.updateClaimConditions(obc)
+		return requeueAfter(err, tx.attempts)
+	}
+
+	Log.Error(err, "provisioning cannot succeed, rolling back", "attempts", tx.failures)
+	if rbErr := r.rollbackProvisioning(obc, tx, p); rbErr != nil {
+		// The claim keeps its finalizer and the rollback is retried on the next reconcile.
+		Log.Error(rbErr, "rollback failed")
+		r.recorder.Event(obc, corev1.EventTypeWarning, eventRollbackFailed, errorMessage(rbErr))
+		r.updateClaimConditions(obc)
+		return requeueAfter(rbErr, tx.attempts)
+	}
+	msg := fmt.Sprintf("provisioning rolled back after %d attempts", tx.failures)
+	r.recorder.Event(obc, corev1.EventTypeWarning, eventRolledBack, msg)
+	setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionFalse, reasonRolledBack, msg)
+	setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionFalse, reasonRolledBack, msg)
+	setClaimCondition(obc, v1alpha1.ConditionConfigReady, corev1.ConditionFalse, reasonRolledBack, msg)
+	err = r.setClaimPhaseFailed(obc, fmt.Sprintf("provisioning failed after %d attempts: %v", tx.failures, err))
+	if err != nil {
+		return err
+	}
+	err = r.unlockObject(obc)
+	if err != nil {
+		return err
+	}
+	r.transactions.forget(obc.UID)
+	return nil
 }
 
-func (r *ReconcileObjectBucketClaim) handleProvisionClaim(obc *v1alpha1.ObjectBucketClaim, sc *storagev1.StorageClass) error {
+// provisionClaim performs the provisioning steps in order.  Each step tolerates the artifacts of a previous, partially
+// successful attempt so that a retry resumes where the last attempt stopped.  params are the merged StorageClass and
+// claim parameters passed to the plugin, and layout is the resolved layout of the claim's Secret and ConfigMap.
+func (r *ReconcileObjectBucketClaim) provisionClaim(obc *v1alpha1.ObjectBucketClaim, sc *storagev1.StorageClass, params map[string]string, layout *v1alpha1.ConnectionLayout, tx *provisionTransaction, p *pluginClient) error {
 
 	// Errors caused by existing resources indicates this is a retry on a partially successful sync (probably?)
 	// Name collisions are controlled because they are derived from OBCs.  An OBC name collision would be caught by the
@@ -158,17 +325,83 @@ func (r *ReconcileObjectBucketClaim) handleProvisionClaim(obc *v1alpha1.ObjectBu
 		return err
 	}
 
-	Debug.Info("provisioning bucket", "OBC", fmt.Sprintf("%s/%s", obc.Namespace, obc.Name))
-	resp, err := grpcClient.Provision(r.ctx, &cosi.ProvisionRequest{
-		RequestBucketName: obc.Spec.BucketName,
-		Parameters:        getClassParameters(sc),
-	})
+	// The generated name must be persisted before calling the plugin so that a retry of a partially successful sync
+	// requests the same bucket rather than a new one.  Brownfield claims record the bucket named by their class.
+	if bucket, ok := brownfieldBucket(sc); ok {
+		err = r.setOBCBucketName(obc, bucket)
+		if isFatalError(err) {
+			return err
+		}
+	} else if obc.Spec.BucketName == "" {
+		err = r.setGeneratedBucketName(obc, generateBucketName(obc.Spec.GenerateBucketName))
+		if isFatalError(err) {
+			return err
+		}
+	}
+
+	resp := tx.provisioned
+	if resp == nil {
+		rpcCtx, cancel := r.rpcContext(r.ctx)
+		if tx.brownfield {
+			Debug.Info("requesting access to existing bucket", "BucketName", obc.Spec.BucketName)
+			resp, err = p.access.grantAccess(rpcCtx, obc.Spec.BucketName, params)
+		} else {
+			Debug.Info("provisioning bucket", "OBC", fmt.Sprintf("%s/%s", obc.Namespace, obc.Name))
+			resp, err = p.provisioner.Provision(rpcCtx, &cosi.ProvisionRequest{
+				RequestBucketName: obc.Spec.BucketName,
+				Parameters:        params,
+			})
+		}
+		cancel()
+		setClaimPluginReachable(obc, err)
+		if status.Code(err) == codes.AlreadyExists && !tx.brownfield && obc.Status.ProvisionedBucketName == obc.Spec.BucketName {
+			// The bucket is the claim's own, provisioned by an attempt whose transaction was lost.
+			Log.Info("bucket was provisioned by an earlier attempt, recovering its connection", "BucketName", obc.Spec.BucketName)
+			resp, err = r.recoverProvisioned(obc, params, p)
+		}
+		if isFatalError(err) {
+			setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionFalse, reasonProvisionFailed, err.Error())
+			return err
+		}
+		tx.provisioned = resp
+		if tx.brownfield {
+			r.recorder.Eventf(obc, corev1.EventTypeNormal, eventAccessGranted, "access granted to existing bucket %q", resp.BucketName)
+		} else {
+			r.recorder.Eventf(obc, corev1.EventTypeNormal, eventBucketCreated, "bucket %q created", resp.BucketName)
+		}
+	}
+	// The transaction is lost if the driver restarts, so the bucket is recorded on the claim before anything else
+	// depends on it.
+	if obc.Status.ProvisionedBucketName != resp.BucketName {
+		obc.Status.ProvisionedBucketName = resp.BucketName
+		err = r.writeClaimStatus(obc)
+		if err != nil {
+			return err
+		}
+	}
+	if tx.brownfield {
+		setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionTrue, reasonAccessGranted, "")
+	} else {
+		setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionTrue, reasonBucketProvisioned, "")
+	}
+
+	// A layout the response cannot fill is refused before anything is bound to the bucket.
+	if err = checkConnectionLayout(obc, resp, layout); err != nil {
+		setClaimCondition(obc, v1alpha1.ConditionConfigReady, corev1.ConditionFalse, reasonLayoutConflict, err.Error())
+		return err
+	}
+
+	ob, err := r.createObjectBucket(obc, resp, params, layout, sc.ReclaimPolicy, tx.brownfield)
 	if isFatalError(err) {
 		return err
 	}
+	r.recorder.Eventf(ob, corev1.EventTypeNormal, eventBound, "bound to claim %s/%s", obc.Namespace, obc.Name)
 
-	ob, err := r.createObjectBucket(obc, resp, sc.ReclaimPolicy)
+	auth := v1alpha1.NewAuthentication(resp.GetEnvironmentCredentials())
+	Debug.Info("sorted plugin credentials", "types", auth.Types())
+	err = r.createCredentialsSecret(ob, auth)
 	if isFatalError(err) {
+		setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionFalse, reasonSecretFailed, err.Error())
 		return err
 	}
 
@@ -177,54 +410,289 @@ func (r *ReconcileObjectBucketClaim) handleProvisionClaim(obc *v1alpha1.ObjectBu
 		return err
 	}
 
-	_, err = r.createChildSecret(obc, resp.GetEnvironmentCredentials())
+	_, err = r.createChildSecret(obc, ob, auth)
 	if isFatalError(err) {
+		setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionFalse, reasonSecretFailed, err.Error())
 		return err
 	}
-	_, err = r.createChildConfigMap(obc, resp)
+	setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionTrue, reasonSecretCreated, "")
+	r.recorder.Eventf(obc, corev1.EventTypeNormal, eventCredentialsPublished, "credentials written to Secret %q", childResourceName(obc.Name))
+
+	_, err = r.createChildConfigMap(obc, ob)
 	if isFatalError(err) {
+		setClaimCondition(obc, v1alpha1.ConditionConfigReady, corev1.ConditionFalse, reasonConfigMapFailed, err.Error())
 		return err
 	}
+	setClaimCondition(obc, v1alpha1.ConditionConfigReady, corev1.ConditionTrue, reasonConfigMapCreated, "")
+	r.recorder.Eventf(obc, corev1.EventTypeNormal, eventConfigPublished, "connection data written to ConfigMap %q", childResourceName(obc.Name))
 
 	err = r.setClaimPhaseBound(obc)
 	if isFatalError(err) {
 		return err
 	}
-
-	Debug.Info("provisioning succeeded")
+	r.recorder.Eventf(obc, corev1.EventTypeNormal, eventBound, "bound to ObjectBucket %q", ob.Name)
 	return nil
 }
 
-func (r *ReconcileObjectBucketClaim) handleDeprovisionClaim(obc *v1alpha1.ObjectBucketClaim) error {
-	Log.Info("deprovisioning bucket", "OBC", fmt.Sprintf("%s/%s", obc.Namespace, obc.Name))
-	// TODO right now we ignore the response, the prototype plugin doesn't send anything meaningful
-	_, err := grpcClient.Deprovision(r.ctx, &cosi.DeprovisionRequest{
-		BucketName: obc.Spec.BucketName,
-	})
+// recoverProvisioned rebuilds the response to the Provision call that created the claim's bucket.  The OB of an earlier
+// attempt holds the bucket's connection and credentials; without it, the plugin is asked to issue new credentials for
+// the bucket as it is for a rotation.
+func (r *ReconcileObjectBucketClaim) recoverProvisioned(obc *v1alpha1.ObjectBucketClaim, params map[string]string, p *pluginClient) (*cosi.ProvisionResponse, error) {
+	ob, err := r.getClaimObjectBucket(obc)
+	if err != nil {
+		return nil, err
+	}
+	if ob != nil && ob.Spec.Connection != nil && ob.Spec.Endpoint != nil {
+		auth, err := r.objectBucketCredentials(ob)
+		if err == nil {
+			return &cosi.ProvisionResponse{
+				BucketName:             ob.Spec.Endpoint.BucketName,
+				Endpoint:               ob.Spec.Endpoint.BucketHost,
+				Region:                 ob.Spec.Endpoint.Region,
+				EnvironmentCredentials: auth.ToMap(),
+				Data:                   ob.Spec.AdditionalState,
+			}, nil
+		}
+		if client.IgnoreNotFound(err) != nil && !errors.Is(err, errNoCredentialsRef) {
+			return nil, err
+		}
+	}
+
+	if !p.supports(plugin.CapabilityCredentialRotation) {
+		// Not terminal: once the retry budget is spent, the rollback deprovisions the bucket.
+		return nil, fmt.Errorf("the credentials of bucket %q were lost and the plugin does not support credential rotation to reissue them",
+			obc.Spec.BucketName)
+	}
+	rpcCtx, cancel := r.rpcContext(r.ctx)
+	defer cancel()
+	resp, err := p.access.grantAccess(rpcCtx, obc.Spec.BucketName, params)
+	setClaimPluginReachable(obc, err)
+	return resp, err
+}
+
+// rollbackProvisioning undoes the steps of provisionClaim in reverse order, except for the finalizer which is left for
+// the caller to release once the claim is marked Failed.  Children are deleted by their derived names since an earlier
+// attempt may have created them.  The bucket is only deprovisioned if this driver is known to have provisioned it,
+// either by the transaction or, after a restart, by the claim's status.
+func (r *ReconcileObjectBucketClaim) rollbackProvisioning(obc *v1alpha1.ObjectBucketClaim, tx *provisionTransaction, p *pluginClient) error {
+	Log.Info("rolling back provisioning", "OBC", fmt.Sprintf("%s/%s", obc.Namespace, obc.Name))
+
+	cm := new(corev1.ConfigMap)
+	cm.SetName(childResourceName(obc.Name))
+	cm.SetNamespace(obc.Namespace)
+	err := r.deleteChildIfOwned(obc, cm, "ConfigMap")
+	if err != nil {
+		return err
+	}
+	sec := new(corev1.Secret)
+	sec.SetName(childResourceName(obc.Name))
+	sec.SetNamespace(obc.Namespace)
+	err = r.deleteChildIfOwned(obc, sec, "Secret")
+	if err != nil {
+		return err
+	}
+
+	if obc.Spec.ObjectBucketName != "" {
+		err = r.setObjectBucketName(obc, "")
+		if err != nil {
+			return err
+		}
+	}
+	ob, err := r.getClaimObjectBucket(obc)
+	if err == nil && ob != nil {
+		// The OB's credentials Secret is garbage collected with it, whichever name it was given.
+		err = r.deleteObjectBucket(ob)
+	}
+	if err != nil {
+		return err
+	}
+
+	bucket := obc.Status.ProvisionedBucketName
+	if tx.provisioned != nil {
+		bucket = tx.provisioned.BucketName
+	}
+	if bucket == "" {
+		return nil
+	}
+	if tx.brownfield {
+		// The claim's OB was deleted above, so access is revoked as for an unbound claim.
+		err = r.revokeBucketAccess(obc, nil, p)
+	} else {
+		Debug.Info("deprovisioning bucket", "BucketName", bucket)
+		var reason string
+		reason, err = r.deprovision(r.ctx, p, bucket)
+		setClaimPluginReachable(obc, err)
+		if err != nil {
+			setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionTrue, reason, err.Error())
+		}
+	}
 	if err != nil {
 		return err
 	}
+	tx.provisioned = nil
+	// Written along with the Failed phase by the caller.
+	obc.Status.ProvisionedBucketName = ""
+	return nil
+}
 
-	err = r.deleteBoundObjectBucket(obc)
-	if err != nil && !apierrs.IsNotFound(err) {
+// handleDeprovisionClaim releases the claim's bucket according to the reclaim policy recorded on the bound OB, or on
+// the StorageClass if the claim was never bound.  Brownfield buckets only have their access revoked, whatever the
+// policy.  The claim's finalizer is only removed once the bucket has been released.  An OB named by the claim but bound
+// to another claim is left alone, as if the claim were unbound.
+func (r *ReconcileObjectBucketClaim) handleDeprovisionClaim(obc *v1alpha1.ObjectBucketClaim, sc *storagev1.StorageClass, p *pluginClient) error {
+	ob, err := r.getBoundObjectBucket(obc)
+	if isNotOwned(err) {
+		Log.Info("ignoring object bucket", "reason", err.Error())
+		ob, err = nil, nil
+	}
+	if err != nil {
 		return err
 	}
+	policy := sc.ReclaimPolicy
+	_, brownfield := brownfieldBucket(sc)
+	if ob != nil {
+		policy = ob.Spec.ReclaimPolicy
+		brownfield = isBrownfieldObjectBucket(ob)
+	}
+
+	switch {
+	case brownfield:
+		err = r.revokeBucketAccess(obc, ob, p)
+	case policy == nil:
+		err = r.refuseDeprovision(obc, ob, errNoReclaimPolicy)
+	case *policy == corev1.PersistentVolumeReclaimDelete:
+		var nonEmpty v1alpha1.NonEmptyBucketPolicy
+		nonEmpty, err = nonEmptyBucketPolicy(sc)
+		if err != nil {
+			err = r.refuseDeprovision(obc, ob, err)
+			break
+		}
+		err = r.deleteBucket(obc, ob, p, nonEmpty)
+	case *policy == corev1.PersistentVolumeReclaimRetain:
+		err = r.retainBucket(obc, ob)
+	default:
+		err = r.refuseDeprovision(obc, ob, fmt.Errorf("unsupported reclaim policy %q", *policy))
+	}
+	if isTerminal(err) {
+		// The claim keeps its finalizer and DeprovisionFailed condition.  Retrying the same request is unlikely to
+		// help, so the claim is only checked again at the longest backoff, in case the cause has been fixed.
+		Log.Error(err, "plugin rejected deprovisioning")
+		return &requeueAfterError{err: err, after: backoffCap}
+	}
+	if err != nil {
+		tx := r.transactions.get(obc.UID)
+		tx.attempts++
+		return requeueAfter(err, tx.attempts)
+	}
 
 	err = r.unlockObject(obc)
 	if err != nil {
 		return err
 	}
 
+	r.transactions.forget(obc.UID)
 	Log.Info("deprovisioning succeeded")
 	return nil
 }
 
-func (r *ReconcileObjectBucketClaim) isSupportedPlugin(name string) bool {
-	match := r.pluginName == name
-	if !match {
-		Log.Info("this OBC is not managed by this provisioner")
+var errNoReclaimPolicy = errors.New("reclaim policy is not set")
+
+// refuseDeprovision reports a reclaim policy the reconciler cannot act on.  The error is returned so that the claim
+// is retried once the policy has been corrected; until then the claim's finalizer holds.
+func (r *ReconcileObjectBucketClaim) refuseDeprovision(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, err error) error {
+	Log.Error(err, "refusing to deprovision")
+	msg := fmt.Sprintf("refusing to deprovision: %v", err)
+	r.recorder.Event(obc, corev1.EventTypeWarning, eventDeprovisionFailed, msg)
+	setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionTrue, reasonInvalidReclaimPolicy, msg)
+	r.updateClaimConditions(obc)
+	if ob != nil {
+		r.recorder.Event(ob, corev1.EventTypeWarning, eventDeprovisionFailed, msg)
+	}
+	return err
+}
+
+// deleteBucket implements the Delete reclaim policy: the bucket is deprovisioned and the OB deleted.  A bucket the
+// plugin reports is not empty is handled according to nonEmpty.
+func (r *ReconcileObjectBucketClaim) deleteBucket(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, p *pluginClient, nonEmpty v1alpha1.NonEmptyBucketPolicy) error {
+	// Without an OB, the bucket name on the claim is only known to be ours if this driver provisioned it.
+	if ob == nil && obc.Status.ProvisionedBucketName == "" {
+		Debug.Info("claim is unbound and no bucket was provisioned for it, nothing to deprovision")
+		return nil
+	}
+	bucket := r.releasedBucketName(obc, ob)
+	Log.Info("deprovisioning bucket", "BucketName", bucket)
+	r.recorder.Eventf(obc, corev1.EventTypeNormal, eventDeprovisioningStarted, "deprovisioning bucket %q", bucket)
+	reason, err := r.deprovision(r.ctx, p, bucket)
+	if reason == reasonBucketNotEmpty {
+		switch {
+		case nonEmpty == v1alpha1.NonEmptyBucketForceEmpty && !p.capabilities.Has(plugin.CapabilityForceEmpty):
+			// A plugin that does not know the metadata could ignore it, so it is never sent; the bucket is left to be
+			// emptied by hand as under NonEmptyBucketFail.
+			err = fmt.Errorf("%s is %s, but the plugin does not support deleting a bucket with its objects: %s",
+				v1alpha1.StorageClassNonEmptyBucketPolicy, nonEmpty, errorMessage(err))
+		case nonEmpty == v1alpha1.NonEmptyBucketForceEmpty:
+			Log.Info("bucket is not empty, deprovisioning it with its objects", "BucketName", bucket)
+			reason, err = r.deprovision(forceEmptyContext(r.ctx), p, bucket)
+		case nonEmpty == v1alpha1.NonEmptyBucketRetain:
+			msg := fmt.Sprintf("bucket %q is not empty and was retained by %s", bucket, v1alpha1.StorageClassNonEmptyBucketPolicy)
+			if ob != nil {
+				setObjectBucketCondition(ob, v1alpha1.ConditionProvisioned, corev1.ConditionTrue, reasonBucketNotEmpty, msg)
+			}
+			return r.retainBucket(obc, ob)
+		}
+	}
+	if err != nil {
+		msg := errorMessage(err)
+		if reason == reasonBucketNotEmpty {
+			msg = fmt.Sprintf("bucket %q is not empty: %s", bucket, msg)
+		}
+		setClaimPluginReachable(obc, err)
+		setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionTrue, reason, msg)
+		r.recorder.Event(obc, corev1.EventTypeWarning, eventDeprovisionFailed, msg)
+		r.updateClaimConditions(obc)
+		if ob != nil {
+			r.reportDeprovisionFailure(ob, reason, err)
+		}
+		return err
+	}
+	msg := fmt.Sprintf("bucket %q deprovisioned", bucket)
+	if reason == reasonBucketAlreadyDeleted {
+		msg = fmt.Sprintf("bucket %q was already deleted", bucket)
+	}
+	r.recorder.Event(obc, corev1.EventTypeNormal, eventDeprovisioned, msg)
+
+	if ob == nil {
+		return nil
+	}
+	r.reportDeprovisioned(ob, reason, msg)
+	return r.deleteObjectBucket(ob)
+}
+
+// retainBucket implements the Retain reclaim policy: the bucket is left in the store and the OB is kept in the Released
+// phase.  Its claimRef is left in place as a record of the claim it was bound to.
+func (r *ReconcileObjectBucketClaim) retainBucket(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket) error {
+	bucket := r.releasedBucketName(obc, ob)
+	Log.Info("retaining bucket", "BucketName", bucket)
+	r.recorder.Eventf(obc, corev1.EventTypeNormal, eventRetained, "bucket %q retained", bucket)
+	if ob == nil || ob.Status.Phase == v1alpha1.ObjectBucketStatusPhaseReleased {
+		return nil
+	}
+	ob.Status.Phase = v1alpha1.ObjectBucketStatusPhaseReleased
+	err := r.writeObjectBucketStatus(ob)
+	if err != nil {
+		return err
+	}
+	r.recorder.Eventf(ob, corev1.EventTypeNormal, eventReleased, "released by deleted claim %s/%s", obc.Namespace, obc.Name)
+	return nil
+}
+
+// pluginFor returns the plugin serving the named provisioner, if it is one of this driver's.
+func (r *ReconcileObjectBucketClaim) pluginFor(provisioner string) (*pluginClient, bool) {
+	p, ok := r.plugins.lookup(provisioner)
+	if !ok {
+		Log.Info("this OBC is not managed by any of this driver's provisioners", "provisioner", provisioner)
 	}
-	return match
+	return p, ok
 }
 
 func (r *ReconcileObjectBucketClaim) storageClassFromClaim(obc *v1alpha1.ObjectBucketClaim) (*storagev1.StorageClass, error) {
@@ -235,129 +703,321 @@ func (r *ReconcileObjectBucketClaim) storageClassFromClaim(obc *v1alpha1.ObjectB
 }
 
 func (r *ReconcileObjectBucketClaim) setClaimPhasePending(obc *v1alpha1.ObjectBucketClaim) error {
-	return r.setPhase(obc, v1alpha1.ObjectBucketClaimStatusPhasePending)
+	return r.setPhase(obc, v1alpha1.ObjectBucketClaimStatusPhasePending, "")
 }
 
 func (r *ReconcileObjectBucketClaim) setClaimPhaseBound(obc *v1alpha1.ObjectBucketClaim) error {
-	return r.setPhase(obc, v1alpha1.ObjectBucketClaimStatusPhaseBound)
+	return r.setPhase(obc, v1alpha1.ObjectBucketClaimStatusPhaseBound, "")
+}
+
+func (r *ReconcileObjectBucketClaim) setClaimPhaseFailed(obc *v1alpha1.ObjectBucketClaim, msg string) error {
+	return r.setPhase(obc, v1alpha1.ObjectBucketClaimStatusPhaseFailed, msg)
 }
 
-func (r *ReconcileObjectBucketClaim) setPhase(obc *v1alpha1.ObjectBucketClaim, p v1alpha1.ObjectBucketClaimStatusPhase) error {
-	Debug.Info("setting claim phase", "new phase", p)
+func (r *ReconcileObjectBucketClaim) setPhase(obc *v1alpha1.ObjectBucketClaim, p v1alpha1.ObjectBucketClaimStatusPhase, msg string) error {
+	Debug.Info("setting claim phase", "new phase", p, "message", msg)
 	obc.Status.Phase = p
-	return r.client.Update(r.ctx, obc)
+	obc.Status.Message = msg
+	return r.writeClaimStatus(obc)
+}
+
+// updateClaimConditions persists conditions set on a failure path, where no later step will write the claim.  Errors
+// are logged rather than returned so that they do not mask the failure being reported.
+func (r *ReconcileObjectBucketClaim) updateClaimConditions(obc *v1alpha1.ObjectBucketClaim) {
+	if err := r.writeClaimStatus(obc); err != nil {
+		Log.Error(err, "failed to update claim conditions")
+	}
 }
 
+// reportDeprovisionFailure records a failed Deprovision call on the bound OB, with the reason given by
+// deprovisionReason.
+func (r *ReconcileObjectBucketClaim) reportDeprovisionFailure(ob *v1alpha1.ObjectBucket, reason string, deprovisionErr error) {
+	r.recorder.Event(ob, corev1.EventTypeWarning, eventDeprovisionFailed, errorMessage(deprovisionErr))
+	setObjectBucketPluginReachable(ob, deprovisionErr)
+	setObjectBucketCondition(ob, v1alpha1.ConditionProvisioned, corev1.ConditionTrue, reason, deprovisionErr.Error())
+	if err := r.writeObjectBucketStatus(ob); err != nil {
+		Log.Error(err, "failed to update object bucket conditions")
+	}
+}
+
+// setOBCBucketName sets the bucket name only if it is still unset on the latest claim, so a name written concurrently
+// by the user is never overwritten.
 func (r *ReconcileObjectBucketClaim) setOBCBucketName(obc *v1alpha1.ObjectBucketClaim, bucket string) error {
-	Debug.Info("setting obc.Spec.BucketName", "BucketName", obc.Spec.BucketName)
-	obc.Spec.BucketName = bucket
-	return r.client.Update(r.ctx, obc)
+	Debug.Info("setting obc.Spec.BucketName", "BucketName", bucket)
+	return r.patchObject(obc, func() error {
+		if obc.Spec.BucketName == "" {
+			obc.Spec.BucketName = bucket
+		}
+		return nil
+	})
+}
+
+// setGeneratedBucketName is setOBCBucketName for a name generated from spec.generateBucketName.  The name is also
+// recorded in generatedBucketNameAnnotation, which tells it apart from a name the user set alongside the prefix.
+func (r *ReconcileObjectBucketClaim) setGeneratedBucketName(obc *v1alpha1.ObjectBucketClaim, bucket string) error {
+	Debug.Info("setting generated obc.Spec.BucketName", "BucketName", bucket)
+	return r.patchObject(obc, func() error {
+		if obc.Spec.BucketName == "" {
+			obc.Spec.BucketName = bucket
+			metav1.SetMetaDataAnnotation(&obc.ObjectMeta, generatedBucketNameAnnotation, bucket)
+		}
+		return nil
+	})
 }
 
 func (r *ReconcileObjectBucketClaim) setObjectBucketName(obc *v1alpha1.ObjectBucketClaim, objectBucketName string) error {
+	if obc.Spec.ObjectBucketName == objectBucketName {
+		return nil
+	}
 	Debug.Info("setting obc.Spec.ObjectBucketName", "ObjectBucketName", objectBucketName)
-	obc.Spec.ObjectBucketName = objectBucketName
-	return r.client.Update(r.ctx, obc)
+	return r.patchObject(obc, func() error {
+		obc.Spec.ObjectBucketName = objectBucketName
+		return nil
+	})
 }
 
-func (r *ReconcileObjectBucketClaim) createChildSecret(obc *v1alpha1.ObjectBucketClaim, accessCredentials map[string]string) (*corev1.Secret, error) {
-	sec := generateSecret(obc, accessCredentials)
+func (r *ReconcileObjectBucketClaim) createChildSecret(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, auth *v1alpha1.Authentication) (*corev1.Secret, error) {
+	sec, err := generateSecret(obc, ob, auth)
+	if err != nil {
+		return nil, err
+	}
 	Debug.Info("creating child secret", "Namespace", sec.Namespace, "Name", sec.Name)
-	err := controllerutil.SetControllerReference(obc, sec, r.scheme)
+	err = controllerutil.SetControllerReference(obc, sec, r.scheme)
 	if err != nil {
 		return nil, err
 	}
 	err = r.client.Create(r.ctx, sec)
+	if apierrs.IsAlreadyExists(err) {
+		return sec, r.checkExistingChild(obc, sec, new(corev1.Secret), "Secret")
+	}
 	return sec, err
 }
 
-func (r *ReconcileObjectBucketClaim) createChildConfigMap(obc *v1alpha1.ObjectBucketClaim, resp *cosi.ProvisionResponse) (*corev1.ConfigMap, error) {
-	cm := generateConfigMap(obc, resp)
+func (r *ReconcileObjectBucketClaim) createChildConfigMap(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket) (*corev1.ConfigMap, error) {
+	cm, err := generateConfigMap(obc, ob)
+	if err != nil {
+		return nil, err
+	}
 	Debug.Info("creating child config map", "Namespace", cm.Namespace, "Name", cm.Name)
 	// TODO push this call down in generate* calls
-	err := controllerutil.SetControllerReference(obc, cm, r.scheme)
+	err = controllerutil.SetControllerReference(obc, cm, r.scheme)
 	if err != nil {
 		return nil, err
 	}
 	err = r.client.Create(r.ctx, cm)
+	if apierrs.IsAlreadyExists(err) {
+		return cm, r.checkExistingChild(obc, cm, new(corev1.ConfigMap), "ConfigMap")
+	}
 	return cm, err
 }
 
-func (r *ReconcileObjectBucketClaim) createObjectBucket(obc *v1alpha1.ObjectBucketClaim, resp *cosi.ProvisionResponse, reclaimPolicy *corev1.PersistentVolumeReclaimPolicy) (*v1alpha1.ObjectBucket, error) {
+// createObjectBucket records params, the configuration that took effect for the bucket, on the OB's endpoint, and
+// layout, from which the claim's children are regenerated.
+func (r *ReconcileObjectBucketClaim) createObjectBucket(obc *v1alpha1.ObjectBucketClaim, resp *cosi.ProvisionResponse, params map[string]string, layout *v1alpha1.ConnectionLayout, reclaimPolicy *corev1.PersistentVolumeReclaimPolicy, brownfield bool) (*v1alpha1.ObjectBucket, error) {
 	ob := generateObjectBucket(obc, resp, reclaimPolicy)
-	Debug.Info("create object bucket", "Name", ob.Name)
-	err := r.client.Create(r.ctx, ob)
-	return ob, err
+	ob.Spec.CredentialsSecretRef = r.credentialsSecretRef(obc)
+	ob.Spec.ConnectionLayout = layout
+	for k, v := range params {
+		ob.Spec.Endpoint.AdditionalConfigData[k] = v
+	}
+	if brownfield {
+		// The bucket predates the claim and is never deleted on its behalf, which Retain describes.
+		retain := corev1.PersistentVolumeReclaimRetain
+		ob.Spec.ReclaimPolicy = &retain
+		ob.SetAnnotations(map[string]string{brownfieldAnnotation: brownfieldAnnotationValue})
+	}
+	// Status is dropped on create by the status subresource, so it is written separately.
+	status := ob.Status.DeepCopy()
+	legacy, err := r.getLegacyObjectBucket(obc)
+	if err != nil {
+		return ob, err
+	}
+	if legacy != nil {
+		// An earlier release created the claim's OB before the driver was upgraded.  It is used as is, along with the
+		// credentials Secret it references.
+		Debug.Info("found object bucket under its legacy name", "Name", legacy.Name)
+		if legacy.Spec.CredentialsSecretRef == nil {
+			legacy.Spec.CredentialsSecretRef = ob.Spec.CredentialsSecretRef
+			if err := r.client.Update(r.ctx, legacy); err != nil {
+				return ob, err
+			}
+		}
+		if legacy.Status.Phase != "" {
+			return legacy, apierrs.NewAlreadyExists(v1alpha1.Resource("objectbuckets"), legacy.Name)
+		}
+		ob = legacy
+	} else {
+		Debug.Info("create object bucket", "Name", ob.Name)
+		err = r.client.Create(r.ctx, ob)
+	}
+	if apierrs.IsAlreadyExists(err) {
+		// A previous attempt may have created the OB but failed to write its status.
+		existing := new(v1alpha1.ObjectBucket)
+		if getErr := r.client.Get(r.ctx, client.ObjectKey{Name: ob.Name}, existing); getErr != nil {
+			return ob, getErr
+		}
+		if ownerErr := checkObjectBucketOwner(existing, obc); ownerErr != nil {
+			return ob, ownerErr
+		}
+		if existing.Status.Phase != "" {
+			return existing, err
+		}
+		ob, err = existing, nil
+	}
+	if err != nil {
+		return ob, err
+	}
+	ob.Status = *status
+	return ob, r.writeObjectBucketStatus(ob)
+}
+
+// getClaimObjectBucket returns the OB created for the claim, which may not be bound to it yet, or nil if there is none.
+// The OB is looked for under its derived name and then under the name given by earlier releases.
+func (r *ReconcileObjectBucketClaim) getClaimObjectBucket(obc *v1alpha1.ObjectBucketClaim) (*v1alpha1.ObjectBucket, error) {
+	ob := new(v1alpha1.ObjectBucket)
+	err := r.client.Get(r.ctx, client.ObjectKey{Name: objectBucketNameForClaim(obc)}, ob)
+	if err == nil && boundToClaim(ob, obc) {
+		return ob, nil
+	}
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	return r.getLegacyObjectBucket(obc)
+}
+
+// getLegacyObjectBucket returns the OB named for the claim by earlier releases, or nil if there is none.  The legacy
+// name is ambiguous, so an OB under it is only returned if it is bound to the claim.
+func (r *ReconcileObjectBucketClaim) getLegacyObjectBucket(obc *v1alpha1.ObjectBucketClaim) (*v1alpha1.ObjectBucket, error) {
+	name := legacyObjectBucketName(obc)
+	if len(name) > maxNameLen {
+		// Earlier releases could not have created it.
+		return nil, nil
+	}
+	ob := new(v1alpha1.ObjectBucket)
+	err := r.client.Get(r.ctx, client.ObjectKey{Name: name}, ob)
+	if apierrs.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !boundToClaim(ob, obc) {
+		return nil, nil
+	}
+	return ob, nil
 }
 
-func (r *ReconcileObjectBucketClaim) deleteBoundObjectBucket(obc *v1alpha1.ObjectBucketClaim) error {
-	Debug.Info("deleting object bucket", "Name", obc.Spec.BucketName)
+// getBoundObjectBucket returns the OB bound to the claim, or nil if the claim is unbound or the OB no longer exists.
+// An OB named by the claim whose claimRef names another claim is never returned, so that editing
+// spec.objectBucketName cannot expose another claim's bucket.
+func (r *ReconcileObjectBucketClaim) getBoundObjectBucket(obc *v1alpha1.ObjectBucketClaim) (*v1alpha1.ObjectBucket, error) {
 	if obc.Spec.ObjectBucketName == "" {
-		return nil
+		return nil, nil
 	}
 	ob := new(v1alpha1.ObjectBucket)
-	key := client.ObjectKey{"", obc.Spec.ObjectBucketName}
-	err := r.client.Get(r.ctx, key, ob)
-	if err != nil && !apierrs.IsNotFound(err) {
+	err := r.client.Get(r.ctx, client.ObjectKey{Name: obc.Spec.ObjectBucketName}, ob)
+	if apierrs.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkObjectBucketOwner(ob, obc); err != nil {
+		return nil, err
+	}
+	return ob, nil
+}
+
+// deleteObjectBucket deletes the OB and releases its finalizer.  It must only be called once the bucket has been
+// deprovisioned or never existed, since the finalizer is what protects a bound OB from deletion.  The OB is deleted
+// first so that the objectbucket controller never sees it undeleted without a finalizer.
+func (r *ReconcileObjectBucketClaim) deleteObjectBucket(ob *v1alpha1.ObjectBucket) error {
+	Debug.Info("deleting object bucket", "Name", ob.Name)
+	err := r.deleteIfExists(ob)
+	if err != nil {
 		return err
 	}
-	return r.client.Delete(r.ctx, ob)
+	return r.unlockObject(ob)
+}
+
+// deleteIfExists deletes obj by name, treating an already absent object as success.
+func (r *ReconcileObjectBucketClaim) deleteIfExists(obj runtime.Object) error {
+	err := r.client.Delete(r.ctx, obj)
+	if apierrs.IsNotFound(err) {
+		return nil
+	}
+	return err
 }
 
-const objectBucketFinalizer = "cosi.io/finalizer"
+const objectBucketFinalizer = v1alpha1.Finalizer
 
 func (r *ReconcileObjectBucketClaim) lockObject(obj runtime.Object) error {
-	Debug.Info("locking object")
-	err := controllerutil.AddFinalizerWithError(obj, objectBucketFinalizer)
-	if err != nil {
-		Log.Error(err, "obj does not implement the runtime.Object interface.  if this happened, a serious bug has"+
-			"been introduced")
-		panic(err)
+	if objectutil.HasFinalizer(obj, objectBucketFinalizer) {
+		return nil
 	}
-	return r.client.Update(r.ctx, obj)
+	Debug.Info("locking object")
+	return r.patchObject(obj, func() error {
+		err := controllerutil.AddFinalizerWithError(obj, objectBucketFinalizer)
+		if err != nil {
+			Log.Error(err, "obj does not implement the runtime.Object interface.  if this happened, a serious bug has"+
+				"been introduced")
+			panic(err)
+		}
+		return nil
+	})
 }
 
 func (r *ReconcileObjectBucketClaim) unlockObject(obj runtime.Object) error {
-	Debug.Info("unlocking object")
-	err := controllerutil.RemoveFinalizerWithError(obj, objectBucketFinalizer)
-	if err != nil {
-		return err
+	if !objectutil.HasFinalizer(obj, objectBucketFinalizer) {
+		return nil
 	}
-	return r.client.Update(r.ctx, obj)
+	Debug.Info("unlocking object")
+	err := r.patchObject(obj, func() error {
+		return controllerutil.RemoveFinalizerWithError(obj, objectBucketFinalizer)
+	})
+	// Removing the last finalizer of a deleted object may race with its removal from the api server.
+	return client.IgnoreNotFound(err)
 }
 
-func generateSecret(obc *v1alpha1.ObjectBucketClaim, accessCredentials map[string]string) *corev1.Secret {
+// generateSecret builds the claim's Secret from auth, with the key layout defined by Authentication.ToMap as renamed by
+// the OB's ConnectionLayout.
+func generateSecret(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, auth *v1alpha1.Authentication) (*corev1.Secret, error) {
+	data, err := secretData(ob, auth)
+	if err != nil {
+		return nil, err
+	}
 	sec := new(corev1.Secret)
 	sec.SetName(childResourceName(obc.Name))
 	sec.SetNamespace(obc.Namespace)
-	sec.StringData = accessCredentials
-	return sec
+	sec.StringData = data
+	return sec, nil
 }
 
-func generateConfigMap(obc *v1alpha1.ObjectBucketClaim, resp *cosi.ProvisionResponse) *corev1.ConfigMap {
+// generateConfigMap derives the claim's ConfigMap from the OB alone, so that it can be regenerated after provisioning.
+func generateConfigMap(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket) (*corev1.ConfigMap, error) {
+	data, err := configMapData(ob)
+	if err != nil {
+		return nil, err
+	}
 	cm := new(corev1.ConfigMap)
 	cm.SetName(childResourceName(obc.Name))
 	cm.SetNamespace(obc.Namespace)
-	// TODO (copejon) I'm thinking the plugin should define the env var and the driver just pass them through.
-	// These hardcoded values are just for tire kicking the prototype
-	cm.Data = map[string]string{
-		"COSI_BUCKET_ENDPOINT": resp.Endpoint,
-		"COSI_BUCKET_REGION":   resp.Region,
-		"COSI_BUCKET_NAME":     resp.BucketName,
-	}
-	for k, v := range resp.Data {
-		cm.Data[k] = v
-	}
-	return cm
+	cm.Data = data
+	return cm, nil
 }
 
 // generateObjectBucket is messier than its cm and sec counterparts because nested structures are not allocated
 // space by new(), so they must be declared inline.
 func generateObjectBucket(obc *v1alpha1.ObjectBucketClaim, resp *cosi.ProvisionResponse, pol *corev1.PersistentVolumeReclaimPolicy) *v1alpha1.ObjectBucket {
+	// The plugin's connection data is kept as additional state so that the claim's ConfigMap can be regenerated.
+	additionalState := make(map[string]string, len(resp.Data))
+	for k, v := range resp.Data {
+		additionalState[k] = v
+	}
 	ob := &v1alpha1.ObjectBucket{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      childResourceName(fmt.Sprintf("%s-%s", obc.Namespace, obc.Name)),
-			Namespace: obc.Namespace,
+			Name:       objectBucketNameForClaim(obc),
+			Finalizers: []string{objectBucketFinalizer},
 		},
 		Spec: v1alpha1.ObjectBucketSpec{
 			ReclaimPolicy:    pol,
@@ -371,28 +1031,114 @@ func generateObjectBucket(obc *v1alpha1.ObjectBucketClaim, resp *cosi.ProvisionR
 					Region:               resp.Region,
 					AdditionalConfigData: map[string]string{},
 				},
-				Authentication: &v1alpha1.Authentication{
-					AdditionalSecretData: resp.EnvironmentCredentials,
-					AccessKeys:           &v1alpha1.AccessKeys{}, // TODO (copejon) should we let plugins decide the env var?
-				},
-				AdditionalState: map[string]string{}, // TODO (copejon) i'm ignoring this for now
+				Authentication:  v1alpha1.NewAuthentication(resp.GetEnvironmentCredentials()),
+				AdditionalState: additionalState,
 			},
 		},
 		Status: v1alpha1.ObjectBucketStatus{Phase: v1alpha1.ObjectBucketStatusPhaseBound},
 	}
+	setObjectBucketCondition(ob, v1alpha1.ConditionProvisioned, corev1.ConditionTrue, reasonBucketProvisioned, "")
+	setObjectBucketPluginReachable(ob, nil)
 	return ob
 }
 
 const prefix = "cosi.io"
 
+const (
+	// maxNameLen is the longest name the api server accepts for the objects the reconciler creates.
+	maxNameLen = validation.DNS1123SubdomainMaxLength
+	// nameHashLen is the number of hex digits of the hash that keeps derived names apart.
+	nameHashLen = 10
+)
+
+// childResourceName names the claim's Secret and ConfigMap.  Applications refer to them by name, so the name stays
+// readable; only a name too long for the api server is truncated and made unique with a hash of the claim name.
 func childResourceName(obcName string) string {
-	return fmt.Sprintf("%s-%s", prefix, obcName)
+	name := fmt.Sprintf("%s-%s", prefix, obcName)
+	if len(name) <= maxNameLen {
+		return name
+	}
+	return hashedName(name, obcName)
+}
+
+// objectBucketNameForClaim qualifies the OB name with the claim namespace since OBs are cluster scoped.  Joining the
+// two with a hyphen is ambiguous, as claim "a-b" in namespace "c" and claim "b" in namespace "c-a" show, so a hash of
+// the namespace and name is appended.
+func objectBucketNameForClaim(obc *v1alpha1.ObjectBucketClaim) string {
+	return hashedName(fmt.Sprintf("%s-%s-%s", prefix, obc.Namespace, obc.Name), obc.Namespace+"/"+obc.Name)
 }
 
-// pendingProvisioning detects if an OB name is set on the OBC.  If so, assume provisioning was
-// already completed.
+// legacyObjectBucketName is the name earlier releases gave the claim's OB, before objectBucketNameForClaim.
+func legacyObjectBucketName(obc *v1alpha1.ObjectBucketClaim) string {
+	return fmt.Sprintf("%s-%s-%s", prefix, obc.Namespace, obc.Name)
+}
+
+// hashedName appends a hash of key to base, truncating base so that the result is a valid name of at most maxNameLen
+// characters.
+func hashedName(base, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])[:nameHashLen]
+	if max := maxNameLen - len(hash) - 1; len(base) > max {
+		// Names must end with an alphanumeric character, which a truncated base may not.
+		base = strings.TrimRight(base[:max], "-.")
+	}
+	return base + "-" + hash
+}
+
+// generatedNameSuffixLen matches the length of the random suffix the api server appends to metadata.generateName
+const generatedNameSuffixLen = v1alpha1.GeneratedBucketNameSuffixLen
+
+// generatedBucketNameAnnotation records on a claim the bucket name the reconciler generated from its prefix.
+const generatedBucketNameAnnotation = "cosi.io/generated-bucket-name"
+
+var (
+	errNoBucketName   = errors.New("one of spec.bucketName or spec.generateBucketName must be set")
+	errBothBucketName = errors.New("spec.bucketName and spec.generateBucketName are mutually exclusive")
+)
+
+// validateBucketName ensures the claim requests its bucket name in exactly one way, and that the name is
+// DNS-compatible.  A claim that has already had a name generated from its prefix will have both fields set, which is
+// permitted.  The admission webhook rejects most invalid claims up front; this catches claims admitted without it.
+func validateBucketName(obc *v1alpha1.ObjectBucketClaim) error {
+	name, prefix := obc.Spec.BucketName, obc.Spec.GenerateBucketName
+	switch {
+	case name == "" && prefix == "":
+		return errNoBucketName
+	case name != "" && prefix != "" && !isGeneratedBucketName(obc):
+		return errBothBucketName
+	case name != "":
+		return v1alpha1.ValidateBucketName(name)
+	}
+	return v1alpha1.ValidateGenerateBucketName(prefix)
+}
+
+// generateBucketName appends a hyphen and random suffix to prefix.  The suffix is drawn from the same alphabet as
+// metadata.generateName and is safe for use in S3 bucket names.
+func generateBucketName(prefix string) string {
+	return fmt.Sprintf("%s-%s", prefix, utilrand.String(generatedNameSuffixLen))
+}
+
+// isGeneratedBucketName reports whether the claim's bucket name was generated by the reconciler.
+func isGeneratedBucketName(obc *v1alpha1.ObjectBucketClaim) bool {
+	name := obc.Spec.BucketName
+	return name != "" && obc.Annotations[generatedBucketNameAnnotation] == name
+}
+
+// pendingProvisioning detects if an OB name is set on the OBC and the claim is bound.  If so, assume provisioning was
+// already completed.  An OB name on an unbound claim means provisioning was interrupted before the children were
+// created.
 func pendingProvisioning(obc *v1alpha1.ObjectBucketClaim) bool {
-	return obc.Spec.ObjectBucketName == ""
+	return !obc.IsBound()
+}
+
+// isBound returns true for claims whose children are maintained by the periodic resync.
+func isBound(obc *v1alpha1.ObjectBucketClaim) bool {
+	return !isDeletionEvent(obc) && obc.IsBound()
+}
+
+// isFailed detects claims that were rejected or rolled back.  Failed is terminal, the claim must be recreated.
+func isFailed(obc *v1alpha1.ObjectBucketClaim) bool {
+	return obc.Status.Phase == v1alpha1.ObjectBucketClaimStatusPhaseFailed
 }
 
 func isDeletionEvent(obc *v1alpha1.ObjectBucketClaim) bool {
@@ -0,0 +1,1510 @@
+package objectbucketclaim
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectutil"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
+	"github.com/yard-turkey/cosi-prototype-interface/cosi"
+)
+
+func TestValidateBucketName(t *testing.T) {
+	tests := []struct {
+		name      string
+		bucket    string
+		prefix    string
+		generated string
+		want      error
+	}{
+		{
+			name:   "bucket name only",
+			bucket: "my-bucket",
+			want:   nil,
+		}, {
+			name:   "prefix only",
+			prefix: "my-bucket",
+			want:   nil,
+		}, {
+			name: "neither defined",
+			want: errNoBucketName,
+		}, {
+			name:   "both defined",
+			bucket: "my-bucket",
+			prefix: "other",
+			want:   errBothBucketName,
+		}, {
+			name:      "bucket name previously generated from prefix",
+			bucket:    "my-bucket-x7k2q",
+			prefix:    "my-bucket",
+			generated: "my-bucket-x7k2q",
+			want:      nil,
+		}, {
+			name:   "bucket name shaped like a generated one",
+			bucket: "my-bucket-x7k2q",
+			prefix: "my-bucket",
+			want:   errBothBucketName,
+		}, {
+			name:      "bucket name changed after generation",
+			bucket:    "my-bucket-other",
+			prefix:    "my-bucket",
+			generated: "my-bucket-x7k2q",
+			want:      errBothBucketName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obc := &v1alpha1.ObjectBucketClaim{
+				Spec: v1alpha1.ObjectBucketClaimSpec{
+					BucketName:         tt.bucket,
+					GenerateBucketName: tt.prefix,
+				},
+			}
+			if tt.generated != "" {
+				obc.Annotations = map[string]string{generatedBucketNameAnnotation: tt.generated}
+			}
+			if got := validateBucketName(obc); got != tt.want {
+				t.Errorf("validateBucketName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateBucketName(t *testing.T) {
+	const prefix = "my-bucket"
+	got := generateBucketName(prefix)
+	if !strings.HasPrefix(got, prefix+"-") || len(got) != len(prefix)+1+generatedNameSuffixLen {
+		t.Errorf("generateBucketName() = %q, want prefix %q and a %d character suffix", got, prefix, generatedNameSuffixLen)
+	}
+	if other := generateBucketName(prefix); other == got {
+		t.Errorf("generateBucketName() returned %q twice, expected random suffixes", got)
+	}
+}
+
+func TestMergeParameters(t *testing.T) {
+	tests := []struct {
+		name        string
+		scParams    map[string]string
+		claimConfig map[string]string
+		want        map[string]string
+		wantErr     bool
+	}{
+		{
+			name:     "class parameters only",
+			scParams: map[string]string{"region": "us-east-1"},
+			want:     map[string]string{"region": "us-east-1"},
+		}, {
+			name: "claim overrides allowed key",
+			scParams: map[string]string{
+				"region":                                "us-east-1",
+				v1alpha1.StorageClassAllowedClaimConfig: "region, tenant",
+			},
+			claimConfig: map[string]string{"region": "eu-west-1", "tenant": "team-a"},
+			want:        map[string]string{"region": "eu-west-1", "tenant": "team-a"},
+		}, {
+			name: "wildcard allows any key",
+			scParams: map[string]string{
+				v1alpha1.StorageClassAllowedClaimConfig: "*",
+			},
+			claimConfig: map[string]string{"tenant": "team-a"},
+			want:        map[string]string{"tenant": "team-a"},
+		}, {
+			name:        "claim sets key not allowed",
+			scParams:    map[string]string{"region": "us-east-1"},
+			claimConfig: map[string]string{"region": "eu-west-1"},
+			wantErr:     true,
+		}, {
+			name: "claim sets reserved key",
+			scParams: map[string]string{
+				v1alpha1.StorageClassAllowedClaimConfig: "*",
+			},
+			claimConfig: map[string]string{v1alpha1.StorageClassBucket: "someone-elses-bucket"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := &storagev1.StorageClass{Parameters: tt.scParams}
+			obc := &v1alpha1.ObjectBucketClaim{
+				Spec: v1alpha1.ObjectBucketClaimSpec{AdditionalConfig: tt.claimConfig},
+			}
+			got, err := mergeParameters(sc, obc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mergeParameters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeParameters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateConfigMap(t *testing.T) {
+	obc := &v1alpha1.ObjectBucketClaim{}
+	obc.Name, obc.Namespace = "my-claim", "my-ns"
+	ob := &v1alpha1.ObjectBucket{
+		Spec: v1alpha1.ObjectBucketSpec{
+			Connection: &v1alpha1.Connection{
+				Endpoint: &v1alpha1.Endpoint{
+					BucketHost: "s3.example.com",
+					BucketName: "my-bucket",
+					Region:     "us-east-1",
+				},
+				AdditionalState: map[string]string{"tenant": "blue"},
+			},
+		},
+	}
+	cm, err := generateConfigMap(obc, ob)
+	if err != nil {
+		t.Fatalf("generateConfigMap() error = %v", err)
+	}
+	if cm.Name != "cosi.io-my-claim" || cm.Namespace != "my-ns" {
+		t.Errorf("generateConfigMap() name = %s/%s, want my-ns/cosi.io-my-claim", cm.Namespace, cm.Name)
+	}
+	want := map[string]string{
+		"COSI_BUCKET_ENDPOINT": "s3.example.com",
+		"COSI_BUCKET_REGION":   "us-east-1",
+		"COSI_BUCKET_NAME":     "my-bucket",
+		"tenant":               "blue",
+	}
+	if !reflect.DeepEqual(cm.Data, want) {
+		t.Errorf("generateConfigMap() data = %v, want %v", cm.Data, want)
+	}
+}
+
+func TestSameData(t *testing.T) {
+	tests := []struct {
+		name     string
+		live     interface{}
+		expected interface{}
+		want     bool
+	}{
+		{
+			name:     "nil and empty",
+			live:     map[string][]byte(nil),
+			expected: map[string][]byte{},
+			want:     true,
+		}, {
+			name:     "equal",
+			live:     map[string]string{"a": "1"},
+			expected: map[string]string{"a": "1"},
+			want:     true,
+		}, {
+			name:     "value modified",
+			live:     map[string]string{"a": "2"},
+			expected: map[string]string{"a": "1"},
+			want:     false,
+		}, {
+			name:     "key removed",
+			live:     map[string][]byte{},
+			expected: map[string][]byte{"a": []byte("1")},
+			want:     false,
+		}, {
+			name:     "key added",
+			live:     map[string]string{"a": "1", "b": "2"},
+			expected: map[string]string{"a": "1"},
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameData(tt.live, tt.expected); got != tt.want {
+				t.Errorf("sameData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiredCapabilities(t *testing.T) {
+	tests := []struct {
+		name   string
+		class  map[string]string
+		params map[string]string
+		want   []plugin.Capability
+	}{
+		{
+			name: "none",
+		}, {
+			name:  "brownfield",
+			class: map[string]string{v1alpha1.StorageClassBucket: "existing"},
+			want:  []plugin.Capability{plugin.CapabilityBrownfield},
+		}, {
+			name:   "quota and versioning",
+			params: map[string]string{"quota": "10Gi", "versioning": "true"},
+			want:   []plugin.Capability{plugin.CapabilityQuota, plugin.CapabilityVersioning},
+		}, {
+			name:   "versioning disabled",
+			params: map[string]string{"versioning": "False"},
+		}, {
+			name:  "force empty",
+			class: map[string]string{v1alpha1.StorageClassNonEmptyBucketPolicy: "ForceEmpty"},
+			want:  []plugin.Capability{plugin.CapabilityForceEmpty},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := &storagev1.StorageClass{Parameters: tt.class}
+			if got := requiredCapabilities(sc, tt.params); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requiredCapabilities() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeprovisionReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "deleted", want: reasonBucketDeleted},
+		{name: "already gone", err: status.Error(codes.NotFound, "no such bucket"), want: reasonBucketAlreadyDeleted},
+		{name: "not empty", err: status.Error(codes.FailedPrecondition, "bucket not empty"), want: reasonBucketNotEmpty},
+		{name: "partial", err: status.Error(codes.Aborted, "deleted 10 of 20 objects"), want: reasonPartiallyDeleted},
+		{name: "other", err: status.Error(codes.Internal, "boom"), want: reasonDeprovisionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deprovisionReason(tt.err); got != tt.want {
+				t.Errorf("deprovisionReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNonEmptyBucketPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    v1alpha1.NonEmptyBucketPolicy
+		wantErr bool
+	}{
+		{name: "default", want: v1alpha1.NonEmptyBucketFail},
+		{name: "force empty", value: "ForceEmpty", want: v1alpha1.NonEmptyBucketForceEmpty},
+		{name: "retain", value: "Retain", want: v1alpha1.NonEmptyBucketRetain},
+		{name: "unsupported", value: "Delete", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := &storagev1.StorageClass{Parameters: map[string]string{}}
+			if tt.value != "" {
+				sc.Parameters[v1alpha1.StorageClassNonEmptyBucketPolicy] = tt.value
+			}
+			got, err := nonEmptyBucketPolicy(sc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nonEmptyBucketPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("nonEmptyBucketPolicy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRotationDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "days", value: "90d", want: 90 * 24 * time.Hour},
+		{name: "duration", value: "36h", want: 36 * time.Hour},
+		{name: "zero", value: "0", want: 0},
+		{name: "negative", value: "-1h", wantErr: true},
+		{name: "negative days", value: "-2d", wantErr: true},
+		{name: "fractional days", value: "1.5d", wantErr: true},
+		{name: "garbage", value: "weekly", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRotationDuration(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRotationDuration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseRotationDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotationPolicyFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    rotationPolicy
+		wantErr bool
+	}{
+		{name: "default", want: rotationPolicy{overlap: defaultRotationOverlap}},
+		{
+			name: "period and overlap",
+			params: map[string]string{
+				v1alpha1.StorageClassCredentialRotationPeriod:  "30d",
+				v1alpha1.StorageClassCredentialRotationOverlap: "1h",
+			},
+			want: rotationPolicy{period: 30 * 24 * time.Hour, overlap: time.Hour},
+		},
+		{
+			name:    "invalid period",
+			params:  map[string]string{v1alpha1.StorageClassCredentialRotationPeriod: "monthly"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rotationPolicyFor(&storagev1.StorageClass{Parameters: tt.params})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rotationPolicyFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("rotationPolicyFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotationDue(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	created := metav1.NewTime(now.Add(-48 * time.Hour))
+	rotatedAt := metav1.NewTime(now.Add(-12 * time.Hour))
+	revokedAt := metav1.NewTime(now.Add(-6 * time.Hour))
+	daily := rotationPolicy{period: 24 * time.Hour, overlap: time.Hour}
+
+	tests := []struct {
+		name        string
+		annotation  string
+		policy      rotationPolicy
+		rotations   []v1alpha1.CredentialRotation
+		expires     time.Time
+		wantTrigger v1alpha1.CredentialRotationTrigger
+		wantRequest string
+	}{
+		{name: "nothing due"},
+		{
+			name:        "requested",
+			annotation:  "2020-06-01",
+			wantTrigger: v1alpha1.CredentialRotationRequested,
+			wantRequest: "2020-06-01",
+		},
+		{
+			name:       "request already handled",
+			annotation: "2020-06-01",
+			rotations: []v1alpha1.CredentialRotation{{
+				Trigger: v1alpha1.CredentialRotationRequested, Request: "2020-06-01", RotatedAt: rotatedAt, RevokedAt: &revokedAt,
+			}},
+		},
+		{
+			name:        "scheduled since creation",
+			policy:      daily,
+			wantTrigger: v1alpha1.CredentialRotationScheduled,
+		},
+		{
+			name:   "scheduled rotation not yet due",
+			policy: daily,
+			rotations: []v1alpha1.CredentialRotation{{
+				Trigger: v1alpha1.CredentialRotationScheduled, RotatedAt: rotatedAt, RevokedAt: &revokedAt,
+			}},
+		},
+		{
+			name:        "session credentials about to expire",
+			expires:     now.Add(sessionRefreshWindow / 2),
+			wantTrigger: v1alpha1.CredentialRotationExpiring,
+		},
+		{
+			name:    "session credentials not yet expiring",
+			expires: now.Add(time.Hour),
+		},
+		{
+			name:       "previous credentials not yet revoked",
+			annotation: "2020-06-01",
+			policy:     daily,
+			rotations: []v1alpha1.CredentialRotation{{
+				Trigger: v1alpha1.CredentialRotationScheduled, RotatedAt: metav1.NewTime(now.Add(-36 * time.Hour)),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obc := &v1alpha1.ObjectBucketClaim{}
+			if tt.annotation != "" {
+				obc.Annotations = map[string]string{v1alpha1.RotateCredentialsAnnotation: tt.annotation}
+			}
+			ob := &v1alpha1.ObjectBucket{}
+			ob.CreationTimestamp = created
+			ob.Status.CredentialRotations = tt.rotations
+			trigger, request := rotationDue(obc, ob, tt.policy, tt.expires, now)
+			if trigger != tt.wantTrigger || request != tt.wantRequest {
+				t.Errorf("rotationDue() = (%q, %q), want (%q, %q)", trigger, request, tt.wantTrigger, tt.wantRequest)
+			}
+		})
+	}
+}
+
+func TestCredentialKeyID(t *testing.T) {
+	tests := []struct {
+		name string
+		auth *v1alpha1.Authentication
+		want string
+	}{
+		{name: "access keys", auth: &v1alpha1.Authentication{AccessKeys: &v1alpha1.AccessKeys{AccessKeyID: "AKID"}}, want: "AKID"},
+		{
+			name: "session credentials",
+			auth: &v1alpha1.Authentication{SessionCredentials: &v1alpha1.SessionCredentials{AccessKeyID: "ASID"}},
+			want: "ASID",
+		},
+		{name: "service account key", auth: &v1alpha1.Authentication{ServiceAccountKey: &v1alpha1.ServiceAccountKey{JSON: "{}"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := credentialKeyID(tt.auth); got != tt.want {
+				t.Errorf("credentialKeyID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendRotation(t *testing.T) {
+	var history []v1alpha1.CredentialRotation
+	for i := 0; i < maxRotationHistory+3; i++ {
+		history = appendRotation(history, v1alpha1.CredentialRotation{KeyID: string(rune('a' + i))})
+	}
+	if len(history) != maxRotationHistory {
+		t.Fatalf("appendRotation() kept %d entries, want %d", len(history), maxRotationHistory)
+	}
+	if got, want := history[len(history)-1].KeyID, string(rune('a'+maxRotationHistory+2)); got != want {
+		t.Errorf("newest entry = %q, want %q", got, want)
+	}
+	if got, want := history[0].KeyID, "d"; got != want {
+		t.Errorf("oldest entry = %q, want %q", got, want)
+	}
+}
+
+func TestConnectionLayoutFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		claim   *v1alpha1.ConnectionLayout
+		want    *v1alpha1.ConnectionLayout
+		wantErr bool
+	}{
+		{name: "default"},
+		{
+			name: "class layout",
+			params: map[string]string{
+				v1alpha1.StorageClassConnectionKeys:    "COSI_BUCKET_ENDPOINT=AWS_ENDPOINT_URL, COSI_BUCKET_NAME=S3_BUCKET",
+				v1alpha1.StorageClassConnectionFormats: "AWSCredentials,AWSConfig",
+			},
+			want: &v1alpha1.ConnectionLayout{
+				Keys:    map[string]string{"COSI_BUCKET_ENDPOINT": "AWS_ENDPOINT_URL", "COSI_BUCKET_NAME": "S3_BUCKET"},
+				Formats: []v1alpha1.ConnectionFormat{v1alpha1.ConnectionFormatAWSCredentials, v1alpha1.ConnectionFormatAWSConfig},
+			},
+		},
+		{
+			name: "claim takes precedence",
+			params: map[string]string{
+				v1alpha1.StorageClassConnectionKeys:    "COSI_BUCKET_ENDPOINT=AWS_ENDPOINT_URL,COSI_BUCKET_NAME=S3_BUCKET",
+				v1alpha1.StorageClassConnectionFormats: "AWSCredentials",
+			},
+			claim: &v1alpha1.ConnectionLayout{
+				Keys:    map[string]string{"COSI_BUCKET_NAME": "BUCKET"},
+				Formats: []v1alpha1.ConnectionFormat{v1alpha1.ConnectionFormatJSON},
+			},
+			want: &v1alpha1.ConnectionLayout{
+				Keys:    map[string]string{"COSI_BUCKET_ENDPOINT": "AWS_ENDPOINT_URL", "COSI_BUCKET_NAME": "BUCKET"},
+				Formats: []v1alpha1.ConnectionFormat{v1alpha1.ConnectionFormatJSON},
+			},
+		},
+		{
+			name:    "malformed pair",
+			params:  map[string]string{v1alpha1.StorageClassConnectionKeys: "COSI_BUCKET_NAME"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid layout",
+			claim:   &v1alpha1.ConnectionLayout{Formats: []v1alpha1.ConnectionFormat{"YAML"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := &storagev1.StorageClass{Parameters: tt.params}
+			obc := &v1alpha1.ObjectBucketClaim{Spec: v1alpha1.ObjectBucketClaimSpec{ConnectionLayout: tt.claim}}
+			got, err := connectionLayoutFor(sc, obc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("connectionLayoutFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("connectionLayoutFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateChildrenWithLayout(t *testing.T) {
+	obc := &v1alpha1.ObjectBucketClaim{}
+	obc.Name, obc.Namespace = "my-claim", "my-ns"
+	ob := &v1alpha1.ObjectBucket{
+		Spec: v1alpha1.ObjectBucketSpec{
+			ConnectionLayout: &v1alpha1.ConnectionLayout{
+				Keys: map[string]string{
+					v1alpha1.BucketEndpointKey: "AWS_ENDPOINT_URL",
+					v1alpha1.BucketNameKey:     "S3_BUCKET",
+					"credentials":              "aws-credentials",
+				},
+				Formats: []v1alpha1.ConnectionFormat{
+					v1alpha1.ConnectionFormatAWSCredentials,
+					v1alpha1.ConnectionFormatAWSConfig,
+					v1alpha1.ConnectionFormatRclone,
+				},
+			},
+			Connection: &v1alpha1.Connection{
+				Endpoint: &v1alpha1.Endpoint{
+					BucketHost: "https://s3.example.com",
+					BucketName: "my-bucket",
+					Region:     "us-east-1",
+				},
+				AdditionalState: map[string]string{"tenant": "blue"},
+			},
+		},
+	}
+	auth := &v1alpha1.Authentication{AccessKeys: &v1alpha1.AccessKeys{AccessKeyID: "AKID", SecretAccessKey: "secret"}}
+
+	cm, err := generateConfigMap(obc, ob)
+	if err != nil {
+		t.Fatalf("generateConfigMap() error = %v", err)
+	}
+	wantConfig := map[string]string{
+		"AWS_ENDPOINT_URL":   "https://s3.example.com",
+		"COSI_BUCKET_REGION": "us-east-1",
+		"S3_BUCKET":          "my-bucket",
+		"config":             "[default]\nregion = us-east-1\nendpoint_url = https://s3.example.com\n",
+		"tenant":             "blue",
+	}
+	if !reflect.DeepEqual(cm.Data, wantConfig) {
+		t.Errorf("generateConfigMap() data = %q, want %q", cm.Data, wantConfig)
+	}
+
+	sec, err := generateSecret(obc, ob, auth)
+	if err != nil {
+		t.Fatalf("generateSecret() error = %v", err)
+	}
+	wantSecret := map[string]string{
+		v1alpha1.AwsKeyField:    "AKID",
+		v1alpha1.AwsSecretField: "secret",
+		"aws-credentials":       "[default]\naws_access_key_id = AKID\naws_secret_access_key = secret\n",
+		"rclone.conf": "[cosi]\ntype = s3\nprovider = Other\naccess_key_id = AKID\nsecret_access_key = secret\n" +
+			"endpoint = https://s3.example.com\nregion = us-east-1\n",
+	}
+	if !reflect.DeepEqual(sec.StringData, wantSecret) {
+		t.Errorf("generateSecret() data = %q, want %q", sec.StringData, wantSecret)
+	}
+}
+
+func TestCheckConnectionLayout(t *testing.T) {
+	obc := &v1alpha1.ObjectBucketClaim{}
+	keys := &v1alpha1.ConnectionLayout{Keys: map[string]string{v1alpha1.BucketNameKey: "S3_BUCKET"}}
+	tests := []struct {
+		name    string
+		layout  *v1alpha1.ConnectionLayout
+		resp    *cosi.ProvisionResponse
+		wantErr bool
+	}{
+		{
+			name:   "no collision",
+			layout: keys,
+			resp:   &cosi.ProvisionResponse{BucketName: "b", Data: map[string]string{"tenant": "blue"}},
+		},
+		{
+			name:    "collides with plugin data",
+			layout:  keys,
+			resp:    &cosi.ProvisionResponse{BucketName: "b", Data: map[string]string{"S3_BUCKET": "other"}},
+			wantErr: true,
+		},
+		{
+			name:    "default key collides with plugin data",
+			resp:    &cosi.ProvisionResponse{BucketName: "b", Data: map[string]string{v1alpha1.BucketRegionKey: "eu"}},
+			wantErr: true,
+		},
+		{
+			name:    "format without the credentials it needs",
+			layout:  &v1alpha1.ConnectionLayout{Formats: []v1alpha1.ConnectionFormat{v1alpha1.ConnectionFormatAWSCredentials}},
+			resp:    &cosi.ProvisionResponse{BucketName: "b", EnvironmentCredentials: map[string]string{"token": "t"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkConnectionLayout(obc, tt.resp, tt.layout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkConnectionLayout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !isTerminal(err) {
+				t.Errorf("isTerminal(%v) = false, want true", err)
+			}
+		})
+	}
+}
+
+func TestObjectBucketNameForClaim(t *testing.T) {
+	claim := func(namespace, name string) *v1alpha1.ObjectBucketClaim {
+		obc := &v1alpha1.ObjectBucketClaim{}
+		obc.Namespace, obc.Name = namespace, name
+		return obc
+	}
+	a, b := objectBucketNameForClaim(claim("c", "a-b")), objectBucketNameForClaim(claim("c-a", "b"))
+	if a == b {
+		t.Errorf("claims c/a-b and c-a/b both map to object bucket %q", a)
+	}
+	if got := objectBucketNameForClaim(claim("c", "a-b")); got != a {
+		t.Errorf("objectBucketNameForClaim() = %q, then %q; want a stable name", a, got)
+	}
+
+	long := objectBucketNameForClaim(claim(strings.Repeat("n", 63), strings.Repeat("a", 252)+"-b"))
+	if msgs := validation.IsDNS1123Subdomain(long); len(msgs) > 0 {
+		t.Errorf("objectBucketNameForClaim() = %q, which is not a valid name: %v", long, msgs)
+	}
+	other := objectBucketNameForClaim(claim(strings.Repeat("n", 63), strings.Repeat("a", 252)+"-c"))
+	if long == other {
+		t.Errorf("claims differing past the truncation both map to object bucket %q", long)
+	}
+}
+
+func TestChildResourceName(t *testing.T) {
+	if got, want := childResourceName("my-claim"), "cosi.io-my-claim"; got != want {
+		t.Errorf("childResourceName() = %q, want %q", got, want)
+	}
+	name := strings.Repeat("a", 250) + ".b"
+	got := childResourceName(name)
+	if msgs := validation.IsDNS1123Subdomain(got); len(msgs) > 0 {
+		t.Errorf("childResourceName(%q) = %q, which is not a valid name: %v", name, got, msgs)
+	}
+	if other := childResourceName(strings.Repeat("a", 250) + ".c"); got == other {
+		t.Errorf("claims differing past the truncation both map to %q", got)
+	}
+}
+
+func TestBoundToClaim(t *testing.T) {
+	obc := &v1alpha1.ObjectBucketClaim{}
+	obc.Namespace, obc.Name, obc.UID = "my-ns", "my-claim", types.UID("uid-1")
+	tests := []struct {
+		name string
+		ref  *corev1.ObjectReference
+		want bool
+	}{
+		{name: "bound", ref: &corev1.ObjectReference{Namespace: "my-ns", Name: "my-claim", UID: "uid-1"}, want: true},
+		{name: "bound without uid", ref: &corev1.ObjectReference{Namespace: "my-ns", Name: "my-claim"}, want: true},
+		{name: "no claim ref"},
+		{name: "other claim", ref: &corev1.ObjectReference{Namespace: "my-ns", Name: "other", UID: "uid-2"}},
+		{name: "deleted claim of the same name", ref: &corev1.ObjectReference{Namespace: "my-ns", Name: "my-claim", UID: "uid-0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := &v1alpha1.ObjectBucket{Spec: v1alpha1.ObjectBucketSpec{ClaimRef: tt.ref}}
+			if got := boundToClaim(ob, obc); got != tt.want {
+				t.Errorf("boundToClaim() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckController(t *testing.T) {
+	obc := &v1alpha1.ObjectBucketClaim{}
+	obc.Name, obc.UID = "my-claim", types.UID("uid-1")
+	controlled := func(uid types.UID) *corev1.Secret {
+		sec := &corev1.Secret{}
+		sec.Name = "cosi.io-my-claim"
+		if uid != "" {
+			isController := true
+			sec.OwnerReferences = []metav1.OwnerReference{{Name: "my-claim", UID: uid, Controller: &isController}}
+		}
+		return sec
+	}
+	if err := checkController(controlled("uid-1"), obc, "Secret"); err != nil {
+		t.Errorf("checkController() on the claim's Secret error = %v", err)
+	}
+	for name, sec := range map[string]*corev1.Secret{"unowned": controlled(""), "owned by another claim": controlled("uid-2")} {
+		err := checkController(sec, obc, "Secret")
+		if !isNotOwned(err) || !isTerminal(err) {
+			t.Errorf("checkController() on %s Secret error = %v, want a terminal notOwnedError", name, err)
+		}
+	}
+}
+
+// newTestReconciler returns a reconciler backed by a fake client holding objs, with plugins keyed by provisioner name.
+func newTestReconciler(t *testing.T, plugins map[string]*pluginClient, objs ...runtime.Object) *ReconcileObjectBucketClaim {
+	// The fake client decodes objects with the client-go scheme, so the driver's types are registered there too.
+	if err := v1alpha1.AddToScheme(clientgoscheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme, objs...)
+	return &ReconcileObjectBucketClaim{
+		client:               c,
+		apiReader:            c,
+		recorder:             &record.FakeRecorder{},
+		scheme:               clientgoscheme.Scheme,
+		plugins:              pluginMap(plugins),
+		ctx:                  context.Background(),
+		transactions:         newTransactionTracker(),
+		provisionRetryBudget: defaultProvisionRetryBudget,
+	}
+}
+
+// fakeProvisioner is a plugin that grants every request, unless provisionErr or deprovisionErr is set.  Each call is
+// recorded as the method, the bucket and the metadata it was sent with, leaving out values that are just "true".  If exists is set, the bucket is already
+// in the store and only credentials for it can be requested.  If notEmpty is set, the bucket is only deleted with its
+// objects.
+type fakeProvisioner struct {
+	provisionErr   error
+	deprovisionErr error
+	exists         bool
+	notEmpty       bool
+	calls          []string
+}
+
+func (f *fakeProvisioner) record(ctx context.Context, method, bucket string) metadata.MD {
+	call := method + " " + bucket
+	md, _ := metadata.FromOutgoingContext(ctx)
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		call += " " + k
+		if v := strings.Join(md[k], ","); v != "true" {
+			call += "=" + v
+		}
+	}
+	f.calls = append(f.calls, call)
+	return md
+}
+
+func (f *fakeProvisioner) GetPluginName(ctx context.Context, in *cosi.PluginNameRequest, opts ...grpc.CallOption) (*cosi.PluginNameResponse, error) {
+	return &cosi.PluginNameResponse{}, nil
+}
+
+func (f *fakeProvisioner) Provision(ctx context.Context, in *cosi.ProvisionRequest, opts ...grpc.CallOption) (*cosi.ProvisionResponse, error) {
+	f.record(ctx, "Provision", in.RequestBucketName)
+	if f.provisionErr != nil {
+		return nil, f.provisionErr
+	}
+	if f.exists {
+		return nil, status.Error(codes.AlreadyExists, "bucket already exists")
+	}
+	return &cosi.ProvisionResponse{
+		BucketName: in.RequestBucketName,
+		Endpoint:   "https://s3.example.com",
+		EnvironmentCredentials: map[string]string{
+			v1alpha1.AwsKeyField:    "AKIDEXAMPLE",
+			v1alpha1.AwsSecretField: "secret",
+		},
+	}, nil
+}
+
+func (f *fakeProvisioner) grantAccess(ctx context.Context, bucket string, params map[string]string) (*cosi.ProvisionResponse, error) {
+	f.record(ctx, "GrantAccess", bucket)
+	if f.provisionErr != nil {
+		return nil, f.provisionErr
+	}
+	return &cosi.ProvisionResponse{
+		BucketName: bucket,
+		Endpoint:   "https://s3.example.com",
+		EnvironmentCredentials: map[string]string{
+			v1alpha1.AwsKeyField:    "AKIDEXAMPLE",
+			v1alpha1.AwsSecretField: "secret",
+		},
+	}, nil
+}
+
+func (f *fakeProvisioner) revokeAccess(ctx context.Context, bucket, keyID string) error {
+	f.record(ctx, "RevokeAccess", bucket+" "+keyID)
+	return f.deprovisionErr
+}
+
+func (f *fakeProvisioner) Deprovision(ctx context.Context, in *cosi.DeprovisionRequest, opts ...grpc.CallOption) (*cosi.DeprovisionResponse, error) {
+	md := f.record(ctx, "Deprovision", in.BucketName)
+	if f.deprovisionErr != nil {
+		return nil, f.deprovisionErr
+	}
+	if f.notEmpty && len(md[forceEmptyMetadataKey]) == 0 {
+		return nil, status.Error(codes.FailedPrecondition, "bucket is not empty")
+	}
+	return &cosi.DeprovisionResponse{}, nil
+}
+
+// healthyPlugin always passes its health check.
+type healthyPlugin struct{}
+
+func (healthyPlugin) Healthy() error { return nil }
+
+func (healthyPlugin) Interval() time.Duration { return time.Second }
+
+const testProvisioner = "cosi.example.com"
+
+func TestReconcile(t *testing.T) {
+	deletePolicy, retainPolicy := corev1.PersistentVolumeReclaimDelete, corev1.PersistentVolumeReclaimRetain
+	class := func(name string, policy corev1.PersistentVolumeReclaimPolicy, params map[string]string) *storagev1.StorageClass {
+		return &storagev1.StorageClass{
+			ObjectMeta:    metav1.ObjectMeta{Name: name},
+			Provisioner:   testProvisioner,
+			ReclaimPolicy: &policy,
+			Parameters:    params,
+		}
+	}
+	classes := []runtime.Object{
+		class("delete", deletePolicy, nil),
+		class("retain", retainPolicy, nil),
+		class("brownfield", deletePolicy, map[string]string{v1alpha1.StorageClassBucket: "existing"}),
+		class("force-empty", deletePolicy, map[string]string{v1alpha1.StorageClassNonEmptyBucketPolicy: "ForceEmpty"}),
+	}
+	// unowned is a ConfigMap under the claim's child name that the claim did not create.
+	unowned := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: childResourceName("my-claim")}}
+
+	tests := []struct {
+		name           string
+		class          string
+		bucket         string
+		provisionErr   error
+		deprovisionErr error
+		// exists is set if the bucket is already in the store, notEmpty if it holds objects.
+		exists   bool
+		notEmpty bool
+		existing []runtime.Object
+		// provisioned is the bucket recorded on the claim by a previous run of the driver, whose transaction was lost.
+		provisioned string
+		// deleted starts with a claim being deleted; delete deletes the claim once it has been reconciled.
+		deleted bool
+		delete  bool
+		// dropCapabilities takes the plugin's capabilities away before the claim is deleted.
+		dropCapabilities bool
+		wantPhase        v1alpha1.ObjectBucketClaimStatusPhase
+		wantCalls        []string
+		// wantOB is the phase of the claim's OB, or "" if it must not exist.
+		wantOB v1alpha1.ObjectBucketStatusPhase
+		// wantFinalizer is whether the claim still holds its finalizer.
+		wantFinalizer bool
+		// wantRequeue is the delay before the claim is reconciled again, if checked.
+		wantRequeue time.Duration
+	}{
+		{
+			name:          "provision binds the claim",
+			class:         "delete",
+			bucket:        "my-bucket",
+			wantPhase:     v1alpha1.ObjectBucketClaimStatusPhaseBound,
+			wantCalls:     []string{"Provision my-bucket"},
+			wantOB:        v1alpha1.ObjectBucketStatusPhaseBound,
+			wantFinalizer: true,
+		},
+		{
+			name:      "delete policy deprovisions the bucket",
+			class:     "delete",
+			bucket:    "my-bucket",
+			delete:    true,
+			wantPhase: v1alpha1.ObjectBucketClaimStatusPhaseBound,
+			wantCalls: []string{"Provision my-bucket", "Deprovision my-bucket"},
+		},
+		{
+			name:      "retain policy releases the bucket",
+			class:     "retain",
+			bucket:    "my-bucket",
+			delete:    true,
+			wantPhase: v1alpha1.ObjectBucketClaimStatusPhaseBound,
+			wantCalls: []string{"Provision my-bucket"},
+			wantOB:    v1alpha1.ObjectBucketStatusPhaseReleased,
+		},
+		{
+			name:      "brownfield claim only has its access revoked",
+			class:     "brownfield",
+			delete:    true,
+			wantPhase: v1alpha1.ObjectBucketClaimStatusPhaseBound,
+			wantCalls: []string{"GrantAccess existing", "RevokeAccess existing AKIDEXAMPLE"},
+		},
+		{
+			name:             "brownfield access is not revoked by a plugin without the capability",
+			class:            "brownfield",
+			delete:           true,
+			dropCapabilities: true,
+			wantPhase:        v1alpha1.ObjectBucketClaimStatusPhaseBound,
+			wantCalls:        []string{"GrantAccess existing"},
+			wantOB:           v1alpha1.ObjectBucketStatusPhaseBound,
+			wantFinalizer:    true,
+		},
+		{
+			name:      "failed brownfield binding revokes the claim's access",
+			class:     "brownfield",
+			existing:  []runtime.Object{unowned},
+			wantPhase: v1alpha1.ObjectBucketClaimStatusPhaseFailed,
+			wantCalls: []string{"GrantAccess existing", "RevokeAccess existing AKIDEXAMPLE"},
+		},
+		{
+			name:      "rejected claim is failed without deprovisioning",
+			class:     "delete",
+			bucket:    "my-bucket",
+			wantPhase: v1alpha1.ObjectBucketClaimStatusPhaseFailed,
+			// The plugin rejects the request outright, so no bucket was provisioned.
+			provisionErr: status.Error(codes.InvalidArgument, "bad request"),
+			wantCalls:    []string{"Provision my-bucket"},
+		},
+		{
+			name:      "failed binding is rolled back",
+			class:     "delete",
+			bucket:    "my-bucket",
+			existing:  []runtime.Object{unowned},
+			wantPhase: v1alpha1.ObjectBucketClaimStatusPhaseFailed,
+			wantCalls: []string{"Provision my-bucket", "Deprovision my-bucket"},
+		},
+		{
+			name:         "rollback after a restart deprovisions the recorded bucket",
+			class:        "delete",
+			bucket:       "my-bucket",
+			provisioned:  "my-bucket",
+			provisionErr: status.Error(codes.InvalidArgument, "bad request"),
+			wantPhase:    v1alpha1.ObjectBucketClaimStatusPhaseFailed,
+			wantCalls:    []string{"Provision my-bucket", "Deprovision my-bucket"},
+		},
+		{
+			name:        "unbound claim deleted after a restart deprovisions the recorded bucket",
+			class:       "delete",
+			bucket:      "my-bucket",
+			provisioned: "my-bucket",
+			deleted:     true,
+			wantPhase:   v1alpha1.ObjectBucketClaimStatusPhasePending,
+			wantCalls:   []string{"Deprovision my-bucket"},
+		},
+		{
+			name:      "non-empty bucket is deleted with its objects",
+			class:     "force-empty",
+			bucket:    "my-bucket",
+			notEmpty:  true,
+			delete:    true,
+			wantPhase: v1alpha1.ObjectBucketClaimStatusPhaseBound,
+			wantCalls: []string{"Provision my-bucket", "Deprovision my-bucket", "Deprovision my-bucket cosi-force-empty"},
+		},
+		{
+			name:             "non-empty bucket is not force emptied by a plugin without the capability",
+			class:            "force-empty",
+			bucket:           "my-bucket",
+			notEmpty:         true,
+			delete:           true,
+			dropCapabilities: true,
+			wantPhase:        v1alpha1.ObjectBucketClaimStatusPhaseBound,
+			wantCalls:        []string{"Provision my-bucket", "Deprovision my-bucket"},
+			wantOB:           v1alpha1.ObjectBucketStatusPhaseBound,
+			wantFinalizer:    true,
+		},
+		{
+			name:        "bucket provisioned before a restart is recovered",
+			class:       "delete",
+			bucket:      "my-bucket",
+			provisioned: "my-bucket",
+			exists:      true,
+			wantPhase:   v1alpha1.ObjectBucketClaimStatusPhaseBound,
+			// Without the OB of the earlier attempt, new credentials are requested for the bucket.
+			wantCalls:     []string{"Provision my-bucket", "GrantAccess my-bucket"},
+			wantOB:        v1alpha1.ObjectBucketStatusPhaseBound,
+			wantFinalizer: true,
+		},
+		{
+			name:      "another claim's bucket is not taken over",
+			class:     "delete",
+			bucket:    "my-bucket",
+			exists:    true,
+			wantPhase: v1alpha1.ObjectBucketClaimStatusPhaseFailed,
+			wantCalls: []string{"Provision my-bucket"},
+		},
+		{
+			name:           "rejected deprovisioning is retried at the longest backoff",
+			class:          "delete",
+			bucket:         "my-bucket",
+			provisioned:    "my-bucket",
+			deleted:        true,
+			deprovisionErr: status.Error(codes.InvalidArgument, "bad request"),
+			wantPhase:      v1alpha1.ObjectBucketClaimStatusPhasePending,
+			wantCalls:      []string{"Deprovision my-bucket"},
+			wantFinalizer:  true,
+			wantRequeue:    backoffCap,
+		},
+		{
+			name:      "unbound claim deleted without a recorded bucket is released",
+			class:     "delete",
+			bucket:    "my-bucket",
+			deleted:   true,
+			wantPhase: v1alpha1.ObjectBucketClaimStatusPhasePending,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obc := &v1alpha1.ObjectBucketClaim{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: "my-claim", UID: types.UID("uid-1")},
+				Spec:       v1alpha1.ObjectBucketClaimSpec{StorageClassName: tt.class, BucketName: tt.bucket},
+			}
+			if tt.provisioned != "" || tt.deleted {
+				obc.Finalizers = []string{objectBucketFinalizer}
+				obc.Status.Phase = v1alpha1.ObjectBucketClaimStatusPhasePending
+				obc.Status.ProvisionedBucketName = tt.provisioned
+			}
+			if tt.deleted {
+				now := metav1.Now()
+				obc.DeletionTimestamp = &now
+			}
+			provisioner := &fakeProvisioner{
+				provisionErr:   tt.provisionErr,
+				deprovisionErr: tt.deprovisionErr,
+				exists:         tt.exists,
+				notEmpty:       tt.notEmpty,
+			}
+			plugins := map[string]*pluginClient{testProvisioner: {
+				provisioner: provisioner,
+				health:      healthyPlugin{},
+				access:      provisioner,
+				capabilities: plugin.Capabilities{
+					plugin.CapabilityBrownfield:         true,
+					plugin.CapabilityCredentialRotation: true,
+					plugin.CapabilityForceEmpty:         true,
+				},
+			}}
+			objs := append(append([]runtime.Object{obc}, classes...), tt.existing...)
+			r := newTestReconciler(t, plugins, objs...)
+			key := client.ObjectKey{Namespace: obc.Namespace, Name: obc.Name}
+			request := reconcile.Request{NamespacedName: key}
+
+			result, err := r.Reconcile(request)
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if tt.dropCapabilities {
+				plugins[testProvisioner].capabilities = nil
+			}
+			if tt.delete {
+				if err := r.client.Get(r.ctx, key, obc); err != nil {
+					t.Fatal(err)
+				}
+				now := metav1.Now()
+				obc.DeletionTimestamp = &now
+				if err := r.client.Update(r.ctx, obc); err != nil {
+					t.Fatal(err)
+				}
+				if result, err = r.Reconcile(request); err != nil {
+					t.Fatalf("Reconcile() of the deleted claim error = %v", err)
+				}
+			}
+			if tt.wantRequeue != 0 && result.RequeueAfter != tt.wantRequeue {
+				t.Errorf("Reconcile() requeues after %v, want %v", result.RequeueAfter, tt.wantRequeue)
+			}
+
+			got := &v1alpha1.ObjectBucketClaim{}
+			if err := r.client.Get(r.ctx, key, got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.Phase != tt.wantPhase {
+				t.Errorf("claim phase = %q, want %q (%s)", got.Status.Phase, tt.wantPhase, got.Status.Message)
+			}
+			if has := objectutil.HasFinalizer(got, objectBucketFinalizer); has != tt.wantFinalizer {
+				t.Errorf("claim has finalizer = %v, want %v", has, tt.wantFinalizer)
+			}
+			if tt.wantPhase == v1alpha1.ObjectBucketClaimStatusPhaseBound && got.Status.ProvisionedBucketName == "" {
+				t.Error("claim status does not record the provisioned bucket")
+			}
+			if !reflect.DeepEqual(provisioner.calls, tt.wantCalls) {
+				t.Errorf("plugin calls = %q, want %q", provisioner.calls, tt.wantCalls)
+			}
+			ob := &v1alpha1.ObjectBucket{}
+			err = r.client.Get(r.ctx, client.ObjectKey{Name: objectBucketNameForClaim(obc)}, ob)
+			switch {
+			case tt.wantOB == "" && !apierrs.IsNotFound(err):
+				t.Errorf("object bucket %q still exists (error %v)", ob.Name, err)
+			case tt.wantOB != "" && err != nil:
+				t.Errorf("object bucket error = %v", err)
+			case tt.wantOB != "" && ob.Status.Phase != tt.wantOB:
+				t.Errorf("object bucket phase = %q, want %q", ob.Status.Phase, tt.wantOB)
+			}
+
+			if tt.wantPhase == v1alpha1.ObjectBucketClaimStatusPhaseBound && !tt.delete {
+				for _, child := range []runtime.Object{&corev1.Secret{}, &corev1.ConfigMap{}} {
+					if err := r.client.Get(r.ctx, client.ObjectKey{Namespace: "my-ns", Name: childResourceName("my-claim")}, child); err != nil {
+						t.Errorf("claim child %T error = %v", child, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPluginSupports(t *testing.T) {
+	capabilities := plugin.Capabilities{plugin.CapabilityCredentialRotation: true, plugin.CapabilityQuota: true}
+	p := &pluginClient{capabilities: capabilities}
+	if p.supports(plugin.CapabilityCredentialRotation) {
+		t.Error("supports() = true for rotation without the access RPCs")
+	}
+	if !p.supports(plugin.CapabilityQuota) {
+		t.Error("supports() = false for a reported capability")
+	}
+	p.access = &fakeProvisioner{}
+	if !p.supports(plugin.CapabilityCredentialRotation) {
+		t.Error("supports() = false for rotation with the access RPCs")
+	}
+}
+
+func TestNextCredentialsSync(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	created := metav1.NewTime(now.Add(-48 * time.Hour))
+	rotatedAt := metav1.NewTime(now.Add(-12 * time.Hour))
+	revokedAt := metav1.NewTime(now.Add(-6 * time.Hour))
+	daily := rotationPolicy{period: 24 * time.Hour, overlap: time.Hour}
+
+	tests := []struct {
+		name      string
+		policy    rotationPolicy
+		rotations []v1alpha1.CredentialRotation
+		expires   time.Time
+		want      time.Duration
+	}{
+		{name: "nothing scheduled"},
+		{
+			name:      "revocation pending without a schedule",
+			rotations: []v1alpha1.CredentialRotation{{RotatedAt: rotatedAt, RevokeAfter: metav1.NewTime(now.Add(2 * time.Hour))}},
+			want:      2 * time.Hour,
+		},
+		{
+			name:      "revocation comes before the next rotation",
+			policy:    daily,
+			rotations: []v1alpha1.CredentialRotation{{RotatedAt: rotatedAt, RevokeAfter: metav1.NewTime(now.Add(time.Hour))}},
+			want:      time.Hour,
+		},
+		{
+			name:      "next rotation after the last",
+			policy:    daily,
+			rotations: []v1alpha1.CredentialRotation{{RotatedAt: rotatedAt, RevokedAt: &revokedAt}},
+			want:      12 * time.Hour,
+		},
+		{
+			name:      "session credentials are refreshed before they expire",
+			policy:    daily,
+			expires:   now.Add(time.Hour),
+			rotations: []v1alpha1.CredentialRotation{{RotatedAt: rotatedAt, RevokedAt: &revokedAt}},
+			want:      time.Hour - sessionRefreshWindow,
+		},
+		{
+			name:   "overdue rotation is retried shortly",
+			policy: daily,
+			want:   time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := &v1alpha1.ObjectBucket{}
+			ob.CreationTimestamp = created
+			ob.Status.CredentialRotations = tt.rotations
+			if got := nextCredentialsSync(ob, tt.policy, tt.expires, now); got != tt.want {
+				t.Errorf("nextCredentialsSync() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEarliest(t *testing.T) {
+	if got := earliest(0, 0); got != 0 {
+		t.Errorf("earliest(0, 0) = %v, want 0", got)
+	}
+	if got := earliest(0, time.Hour, time.Minute); got != time.Minute {
+		t.Errorf("earliest(0, 1h, 1m) = %v, want 1m", got)
+	}
+}
+
+func TestSettlePendingRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		// published is set if the new credentials reached the OB's credentials Secret before the sync was interrupted.
+		published     bool
+		wantCalls     []string
+		wantRotations int
+	}{
+		{
+			name:          "published credentials complete the rotation",
+			published:     true,
+			wantRotations: 1,
+		},
+		{
+			name:      "unpublished credentials are revoked",
+			wantCalls: []string{"RevokeAccess my-bucket AKIDNEW"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obc := &v1alpha1.ObjectBucketClaim{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: "my-claim", UID: types.UID("uid-1")},
+				Spec:       v1alpha1.ObjectBucketClaimSpec{StorageClassName: "delete", BucketName: "my-bucket"},
+			}
+			policy := corev1.PersistentVolumeReclaimDelete
+			sc := &storagev1.StorageClass{
+				ObjectMeta:    metav1.ObjectMeta{Name: "delete"},
+				Provisioner:   testProvisioner,
+				ReclaimPolicy: &policy,
+			}
+			provisioner := &fakeProvisioner{}
+			plugins := map[string]*pluginClient{testProvisioner: {
+				provisioner:  provisioner,
+				health:       healthyPlugin{},
+				access:       provisioner,
+				capabilities: plugin.Capabilities{plugin.CapabilityCredentialRotation: true},
+			}}
+			r := newTestReconciler(t, plugins, obc, sc)
+			key := client.ObjectKey{Namespace: obc.Namespace, Name: obc.Name}
+			if _, err := r.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			// Leave the OB as a sync interrupted after recording a rotation would.
+			ob := &v1alpha1.ObjectBucket{}
+			obKey := client.ObjectKey{Name: objectBucketNameForClaim(obc)}
+			if err := r.client.Get(r.ctx, obKey, ob); err != nil {
+				t.Fatal(err)
+			}
+			ob.Status.CredentialRotations = []v1alpha1.CredentialRotation{{
+				Trigger:       v1alpha1.CredentialRotationRequested,
+				RotatedAt:     metav1.Now(),
+				KeyID:         "AKIDNEW",
+				PreviousKeyID: "AKIDEXAMPLE",
+				RevokeAfter:   metav1.NewTime(time.Now().Add(time.Hour)),
+				Pending:       true,
+			}}
+			if err := r.client.Update(r.ctx, ob); err != nil {
+				t.Fatal(err)
+			}
+			if tt.published {
+				ref := ob.Spec.CredentialsSecretRef
+				sec := &corev1.Secret{}
+				if err := r.client.Get(r.ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, sec); err != nil {
+					t.Fatal(err)
+				}
+				sec.Data[v1alpha1.AwsKeyField] = []byte("AKIDNEW")
+				if err := r.client.Update(r.ctx, sec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			provisioner.calls = nil
+
+			result, err := r.Reconcile(reconcile.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if !reflect.DeepEqual(provisioner.calls, tt.wantCalls) {
+				t.Errorf("plugin calls = %q, want %q", provisioner.calls, tt.wantCalls)
+			}
+			got := &v1alpha1.ObjectBucket{}
+			if err := r.client.Get(r.ctx, obKey, got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Status.CredentialRotations) != tt.wantRotations {
+				t.Fatalf("rotation history = %+v, want %d entries", got.Status.CredentialRotations, tt.wantRotations)
+			}
+			if tt.wantRotations > 0 {
+				if got.Status.CredentialRotations[0].Pending {
+					t.Error("rotation is still pending")
+				}
+				// The claim is requeued for the revocation of the replaced credentials, with the resync disabled.  Their
+				// overlap starts again once the rotation completes.
+				if result.RequeueAfter <= 0 || result.RequeueAfter > defaultRotationOverlap {
+					t.Errorf("Reconcile() requeues after %v, want the revocation within %v", result.RequeueAfter, defaultRotationOverlap)
+				}
+				child := &corev1.Secret{}
+				if err := r.client.Get(r.ctx, client.ObjectKey{Namespace: "my-ns", Name: childResourceName("my-claim")}, child); err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(child.Data[v1alpha1.AwsKeyField]), "AKIDNEW") {
+					t.Errorf("claim Secret was not updated to the new credentials: %q", child.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestReportExpiredCredentials(t *testing.T) {
+	obc := &v1alpha1.ObjectBucketClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: "my-claim"}}
+	setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionTrue, reasonAccessGranted, "")
+	r := newTestReconciler(t, nil, obc)
+
+	r.reportExpiredCredentials(obc, time.Now().Add(time.Hour))
+	if cond := v1alpha1.FindCondition(obc.Status.Conditions, v1alpha1.ConditionCredentialsReady); cond.Status != corev1.ConditionTrue {
+		t.Errorf("CredentialsReady = %v before the credentials expire, want True", cond.Status)
+	}
+	r.reportExpiredCredentials(obc, time.Now().Add(-time.Minute))
+	if cond := v1alpha1.FindCondition(obc.Status.Conditions, v1alpha1.ConditionCredentialsReady); cond.Status != corev1.ConditionFalse || cond.Reason != reasonCredentialsExpired {
+		t.Errorf("CredentialsReady = %v (%s) once the credentials expire, want False (%s)", cond.Status, cond.Reason, reasonCredentialsExpired)
+	}
+}
+
+func TestLegacyObjectBucket(t *testing.T) {
+	tests := []struct {
+		name         string
+		provisionErr error
+		// otherClaim binds the OB under the legacy name to another claim.
+		otherClaim bool
+		wantPhase  v1alpha1.ObjectBucketClaimStatusPhase
+		wantCalls  []string
+		wantLegacy bool
+	}{
+		{
+			name:       "claim is bound to its OB under the legacy name",
+			wantPhase:  v1alpha1.ObjectBucketClaimStatusPhaseBound,
+			wantCalls:  []string{"Provision my-bucket"},
+			wantLegacy: true,
+		},
+		{
+			name:         "rollback deletes the OB under the legacy name",
+			provisionErr: status.Error(codes.InvalidArgument, "bad request"),
+			wantPhase:    v1alpha1.ObjectBucketClaimStatusPhaseFailed,
+			wantCalls:    []string{"Provision my-bucket", "Deprovision my-bucket"},
+		},
+		{
+			name:         "OB under the legacy name bound to another claim is left alone",
+			provisionErr: status.Error(codes.InvalidArgument, "bad request"),
+			otherClaim:   true,
+			wantPhase:    v1alpha1.ObjectBucketClaimStatusPhaseFailed,
+			wantCalls:    []string{"Provision my-bucket", "Deprovision my-bucket"},
+			wantLegacy:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obc := &v1alpha1.ObjectBucketClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:  "my-ns",
+					Name:       "my-claim",
+					UID:        types.UID("uid-1"),
+					Finalizers: []string{objectBucketFinalizer},
+				},
+				Spec:   v1alpha1.ObjectBucketClaimSpec{StorageClassName: "delete", BucketName: "my-bucket"},
+				Status: v1alpha1.ObjectBucketClaimStatus{Phase: v1alpha1.ObjectBucketClaimStatusPhasePending, ProvisionedBucketName: "my-bucket"},
+			}
+			policy := corev1.PersistentVolumeReclaimDelete
+			sc := &storagev1.StorageClass{
+				ObjectMeta:    metav1.ObjectMeta{Name: "delete"},
+				Provisioner:   testProvisioner,
+				ReclaimPolicy: &policy,
+			}
+			legacy := &v1alpha1.ObjectBucket{
+				ObjectMeta: metav1.ObjectMeta{Name: legacyObjectBucketName(obc), UID: types.UID("ob-uid")},
+				Spec: v1alpha1.ObjectBucketSpec{
+					ReclaimPolicy:        &policy,
+					StorageClassName:     "delete",
+					ClaimRef:             makeObjectReference(obc),
+					CredentialsSecretRef: &corev1.SecretReference{Namespace: "my-ns", Name: legacyObjectBucketName(obc)},
+					Connection: &v1alpha1.Connection{
+						Endpoint: &v1alpha1.Endpoint{BucketHost: "https://s3.example.com", BucketName: "my-bucket"},
+					},
+				},
+				Status: v1alpha1.ObjectBucketStatus{Phase: v1alpha1.ObjectBucketStatusPhaseBound},
+			}
+			if tt.otherClaim {
+				legacy.Spec.ClaimRef.UID = types.UID("uid-2")
+			}
+			sec := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: legacyObjectBucketName(obc)},
+				Data: map[string][]byte{
+					v1alpha1.AwsKeyField:    []byte("AKIDEXAMPLE"),
+					v1alpha1.AwsSecretField: []byte("secret"),
+				},
+			}
+			if err := controllerutil.SetControllerReference(legacy, sec, clientgoscheme.Scheme); err != nil {
+				t.Fatal(err)
+			}
+			provisioner := &fakeProvisioner{provisionErr: tt.provisionErr, exists: true}
+			plugins := map[string]*pluginClient{testProvisioner: {provisioner: provisioner, health: healthyPlugin{}}}
+			r := newTestReconciler(t, plugins, obc, sc, legacy, sec)
+			key := client.ObjectKey{Namespace: obc.Namespace, Name: obc.Name}
+
+			if _, err := r.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			got := &v1alpha1.ObjectBucketClaim{}
+			if err := r.client.Get(r.ctx, key, got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.Phase != tt.wantPhase {
+				t.Errorf("claim phase = %q, want %q (%s)", got.Status.Phase, tt.wantPhase, got.Status.Message)
+			}
+			if tt.wantPhase == v1alpha1.ObjectBucketClaimStatusPhaseBound && got.Spec.ObjectBucketName != legacy.Name {
+				t.Errorf("claim bound to OB %q, want %q", got.Spec.ObjectBucketName, legacy.Name)
+			}
+			if !reflect.DeepEqual(provisioner.calls, tt.wantCalls) {
+				t.Errorf("plugin calls = %q, want %q", provisioner.calls, tt.wantCalls)
+			}
+			err := r.client.Get(r.ctx, client.ObjectKey{Name: legacy.Name}, &v1alpha1.ObjectBucket{})
+			if exists := err == nil; exists != tt.wantLegacy {
+				t.Errorf("OB %q exists = %v, want %v (error %v)", legacy.Name, exists, tt.wantLegacy, err)
+			}
+			if err := r.client.Get(r.ctx, client.ObjectKey{Name: objectBucketNameForClaim(obc)}, &v1alpha1.ObjectBucket{}); !apierrs.IsNotFound(err) {
+				t.Errorf("OB was created under the derived name too (error %v)", err)
+			}
+		})
+	}
+}
+
+func TestObjectBucketDeletedUnderClaim(t *testing.T) {
+	obc := &v1alpha1.ObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: "my-claim", UID: types.UID("uid-1")},
+		Spec:       v1alpha1.ObjectBucketClaimSpec{StorageClassName: "delete", BucketName: "my-bucket"},
+	}
+	policy := corev1.PersistentVolumeReclaimDelete
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "delete"}, Provisioner: testProvisioner, ReclaimPolicy: &policy}
+	provisioner := &fakeProvisioner{}
+	plugins := map[string]*pluginClient{testProvisioner: {provisioner: provisioner, health: healthyPlugin{}}}
+	r := newTestReconciler(t, plugins, obc, sc)
+	key := client.ObjectKey{Namespace: obc.Namespace, Name: obc.Name}
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	ob := &v1alpha1.ObjectBucket{}
+	if err := r.client.Get(r.ctx, client.ObjectKey{Name: objectBucketNameForClaim(obc)}, ob); err != nil {
+		t.Fatal(err)
+	}
+	now := metav1.Now()
+	ob.DeletionTimestamp = &now
+	if err := r.client.Update(r.ctx, ob); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	got := &v1alpha1.ObjectBucketClaim{}
+	if err := r.client.Get(r.ctx, key, got); err != nil {
+		t.Fatal(err)
+	}
+	cond := v1alpha1.FindCondition(got.Status.Conditions, v1alpha1.ConditionObjectBucketDeleting)
+	if cond == nil || cond.Status != corev1.ConditionTrue {
+		t.Errorf("ObjectBucketDeleting condition = %+v, want True", cond)
+	}
+	if got.Status.Phase != v1alpha1.ObjectBucketClaimStatusPhaseBound {
+		t.Errorf("claim phase = %q, want it still Bound", got.Status.Phase)
+	}
+	if len(provisioner.calls) != 1 {
+		t.Errorf("plugin calls = %q, want only the provisioning", provisioner.calls)
+	}
+}
@@ -0,0 +1,100 @@
+package objectbucketclaim
+
+import (
+	"errors"
+	"fmt"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	. "github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucketclaim/requestLogger"
+)
+
+// notOwnedError reports an existing object under a name the reconciler derived, which it did not create for the claim
+// and so must not overwrite.  Retrying does not change the outcome.
+type notOwnedError struct {
+	kind string
+	name string
+}
+
+func (e *notOwnedError) Error() string {
+	return fmt.Sprintf("%s %q already exists and does not belong to the claim", e.kind, e.name)
+}
+
+func isNotOwned(err error) bool {
+	var ne *notOwnedError
+	return errors.As(err, &ne)
+}
+
+// ignoreNotOwned drops an ownership error once it has been reported, since requeueing cannot resolve it.  The periodic
+// resync checks the object again.
+func ignoreNotOwned(err error) error {
+	if isNotOwned(err) {
+		return nil
+	}
+	return err
+}
+
+// boundToClaim reports whether the OB's claimRef names the claim.  The UID is compared when both are known, so that an
+// OB left by a deleted claim of the same name is not taken over either.
+func boundToClaim(ob *v1alpha1.ObjectBucket, obc *v1alpha1.ObjectBucketClaim) bool {
+	ref := ob.Spec.ClaimRef
+	if ref == nil || ref.Namespace != obc.Namespace || ref.Name != obc.Name {
+		return false
+	}
+	return ref.UID == "" || obc.UID == "" || ref.UID == obc.UID
+}
+
+// checkObjectBucketOwner returns a notOwnedError if the OB is not bound to the claim.
+func checkObjectBucketOwner(ob *v1alpha1.ObjectBucket, obc *v1alpha1.ObjectBucketClaim) error {
+	if boundToClaim(ob, obc) {
+		return nil
+	}
+	return &notOwnedError{kind: v1alpha1.ObjectBucketKind, name: ob.Name}
+}
+
+// checkController returns a notOwnedError if obj is not controlled by owner.  Every Secret and ConfigMap the reconciler
+// creates has a controller reference, so one without is not adopted.
+func checkController(obj, owner metav1.Object, kind string) error {
+	if metav1.IsControlledBy(obj, owner) {
+		return nil
+	}
+	return &notOwnedError{kind: kind, name: obj.GetName()}
+}
+
+// checkExistingChild is called when creating child found an object of the same name.  It returns nil if the object was
+// created for the claim by an earlier attempt.  The object is read into live, which must be empty: decoding into child
+// would keep the owner reference set on it for the create.
+func (r *ReconcileObjectBucketClaim) checkExistingChild(obc *v1alpha1.ObjectBucketClaim, child, live object, kind string) error {
+	err := r.client.Get(r.ctx, client.ObjectKey{Namespace: child.GetNamespace(), Name: child.GetName()}, live)
+	if err != nil {
+		return err
+	}
+	return checkController(live, obc, kind)
+}
+
+// deleteChildIfOwned deletes one of the claim's children by its derived name, leaving alone an object of that name
+// which the claim does not own.
+func (r *ReconcileObjectBucketClaim) deleteChildIfOwned(obc *v1alpha1.ObjectBucketClaim, child object, kind string) error {
+	err := r.client.Get(r.ctx, client.ObjectKey{Namespace: child.GetNamespace(), Name: child.GetName()}, child)
+	if apierrs.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkController(child, obc, kind); err != nil {
+		Log.Info("not deleting object", "reason", err.Error())
+		return nil
+	}
+	return r.deleteIfExists(child)
+}
+
+// object is a Kubernetes object with metadata, as the children of a claim are.
+type object interface {
+	metav1.Object
+	runtime.Object
+}
@@ -0,0 +1,74 @@
+package objectbucketclaim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+)
+
+// allowAllClaimConfig permits a claim to set any key not reserved by the driver.
+const allowAllClaimConfig = "*"
+
+// reservedParameters are interpreted by the driver and can never be set by a claim.
+var reservedParameters = map[string]bool{
+	v1alpha1.StorageClassBucket:                    true,
+	v1alpha1.StorageClassAllowedClaimConfig:        true,
+	v1alpha1.StorageClassNonEmptyBucketPolicy:      true,
+	v1alpha1.StorageClassCredentialRotationPeriod:  true,
+	v1alpha1.StorageClassCredentialRotationOverlap: true,
+	v1alpha1.StorageClassConnectionKeys:            true,
+	v1alpha1.StorageClassConnectionFormats:         true,
+}
+
+// driverParameters are StorageClass parameters that configure the driver and are not passed to the plugin.
+var driverParameters = map[string]bool{
+	v1alpha1.StorageClassAllowedClaimConfig:        true,
+	v1alpha1.StorageClassNonEmptyBucketPolicy:      true,
+	v1alpha1.StorageClassCredentialRotationPeriod:  true,
+	v1alpha1.StorageClassCredentialRotationOverlap: true,
+	v1alpha1.StorageClassConnectionKeys:            true,
+	v1alpha1.StorageClassConnectionFormats:         true,
+}
+
+// mergeParameters returns the parameters passed to the plugin for a claim.  StorageClass parameters are the defaults
+// and a claim's AdditionalConfig takes precedence over them, but only for keys the class lists in
+// v1alpha1.StorageClassAllowedClaimConfig.  A claim setting any other key is rejected rather than having the value
+// silently dropped.  The allow list and other driverParameters are not passed to the plugin.
+func mergeParameters(sc *storagev1.StorageClass, obc *v1alpha1.ObjectBucketClaim) (map[string]string, error) {
+	params := make(map[string]string)
+	for k, v := range getClassParameters(sc) {
+		if !driverParameters[k] {
+			params[k] = v
+		}
+	}
+
+	allowed := allowedClaimConfig(sc)
+	var denied []string
+	for k, v := range obc.Spec.AdditionalConfig {
+		if reservedParameters[k] || !(allowed[allowAllClaimConfig] || allowed[k]) {
+			denied = append(denied, k)
+			continue
+		}
+		params[k] = v
+	}
+	if len(denied) > 0 {
+		sort.Strings(denied)
+		return nil, fmt.Errorf("spec.additionalConfig sets keys not allowed by StorageClass %q: %s",
+			sc.Name, strings.Join(denied, ", "))
+	}
+	return params, nil
+}
+
+func allowedClaimConfig(sc *storagev1.StorageClass) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, k := range strings.Split(sc.Parameters[v1alpha1.StorageClassAllowedClaimConfig], ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			allowed[k] = true
+		}
+	}
+	return allowed
+}
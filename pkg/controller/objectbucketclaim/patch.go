@@ -0,0 +1,86 @@
+package objectbucketclaim
+
+import (
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	. "github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucketclaim/requestLogger"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectutil"
+)
+
+// patchObject applies mutate to obj and writes only the resulting changes to the api server.  On a conflict the
+// latest obj is read directly from the api server, bypassing the possibly stale cache, and mutate is applied again.
+// mutate must therefore be safe to apply to any version of obj.  Status set on obj but not yet written survives the
+// patch, although the object returned by the api server replaces obj.
+func (r *ReconcileObjectBucketClaim) patchObject(obj runtime.Object, mutate func() error) error {
+	key, err := client.ObjectKeyFromObject(obj)
+	if err != nil {
+		return err
+	}
+	defer keepStatus(obj)()
+	refetch := false
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if refetch {
+			Debug.Info("patch conflict, refetching object", "key", key)
+			if err := r.apiReader.Get(r.ctx, key, obj); err != nil {
+				return err
+			}
+		}
+		refetch = true
+		patch := objectutil.MergeFromWithOptimisticLock(obj)
+		if err := mutate(); err != nil {
+			return err
+		}
+		return r.client.Patch(r.ctx, obj, patch)
+	})
+}
+
+// keepStatus saves the status of a claim or OB and returns a func restoring it.  The reconciler is the only writer of
+// their status, so the status held in memory is the one to keep.
+func keepStatus(obj runtime.Object) func() {
+	switch o := obj.(type) {
+	case *v1alpha1.ObjectBucketClaim:
+		status := o.Status.DeepCopy()
+		return func() { o.Status = *status }
+	case *v1alpha1.ObjectBucket:
+		status := o.Status.DeepCopy()
+		return func() { o.Status = *status }
+	}
+	return func() {}
+}
+
+// writeClaimStatus persists obc.Status through the status subresource.  The reconciler is the only writer of claim
+// status, so on a conflict the desired status is carried over onto the latest claim and written again.
+func (r *ReconcileObjectBucketClaim) writeClaimStatus(obc *v1alpha1.ObjectBucketClaim) error {
+	desired := obc.Status.DeepCopy()
+	key := client.ObjectKey{Namespace: obc.Namespace, Name: obc.Name}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.client.Status().Update(r.ctx, obc)
+		if apierrs.IsConflict(err) {
+			if getErr := r.apiReader.Get(r.ctx, key, obc); getErr != nil {
+				return getErr
+			}
+			obc.Status = *desired
+		}
+		return err
+	})
+}
+
+// writeObjectBucketStatus persists ob.Status through the status subresource.  See writeClaimStatus.
+func (r *ReconcileObjectBucketClaim) writeObjectBucketStatus(ob *v1alpha1.ObjectBucket) error {
+	desired := ob.Status.DeepCopy()
+	key := client.ObjectKey{Name: ob.Name}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.client.Status().Update(r.ctx, ob)
+		if apierrs.IsConflict(err) {
+			if getErr := r.apiReader.Get(r.ctx, key, ob); getErr != nil {
+				return getErr
+			}
+			ob.Status = *desired
+		}
+		return err
+	})
+}
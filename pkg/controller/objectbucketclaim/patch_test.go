@@ -0,0 +1,43 @@
+package objectbucketclaim
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+)
+
+func TestPatchObjectKeepsStatus(t *testing.T) {
+	obc := &v1alpha1.ObjectBucketClaim{}
+	obc.Namespace, obc.Name, obc.UID = "my-ns", "my-claim", types.UID("uid-1")
+	obc.Status.Phase = v1alpha1.ObjectBucketClaimStatusPhasePending
+	setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionFalse, reasonProvisionFailed, "failed attempt")
+	r := newTestReconciler(t, nil, obc.DeepCopy())
+
+	// Status set in memory, as provisionClaim does between its writes, is not yet known to the api server.
+	setClaimCondition(obc, v1alpha1.ConditionProvisioned, corev1.ConditionTrue, reasonBucketProvisioned, "")
+	if err := r.setObjectBucketName(obc, "my-ob"); err != nil {
+		t.Fatal(err)
+	}
+	if obc.Spec.ObjectBucketName != "my-ob" {
+		t.Errorf("spec.objectBucketName = %q, want %q", obc.Spec.ObjectBucketName, "my-ob")
+	}
+	if cond := v1alpha1.FindCondition(obc.Status.Conditions, v1alpha1.ConditionProvisioned); cond == nil || cond.Status != corev1.ConditionTrue {
+		t.Errorf("conditions after patch = %v, want Provisioned=True", obc.Status.Conditions)
+	}
+
+	// The status survives into the next status write.
+	if err := r.writeClaimStatus(obc); err != nil {
+		t.Fatal(err)
+	}
+	got := &v1alpha1.ObjectBucketClaim{}
+	if err := r.client.Get(r.ctx, client.ObjectKey{Namespace: "my-ns", Name: "my-claim"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if cond := v1alpha1.FindCondition(got.Status.Conditions, v1alpha1.ConditionProvisioned); got.Spec.ObjectBucketName != "my-ob" || cond == nil || cond.Status != corev1.ConditionTrue {
+		t.Errorf("stored claim = %+v, want spec.objectBucketName and Provisioned=True", got)
+	}
+}
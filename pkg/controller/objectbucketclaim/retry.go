@@ -0,0 +1,98 @@
+package objectbucketclaim
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucketclaim/requestLogger"
+)
+
+const (
+	// defaultRPCTimeout bounds each call to the plugin, so that a hung plugin cannot stall a reconcile worker.
+	defaultRPCTimeout = 30 * time.Second
+	// rpcTimeoutEnv overrides defaultRPCTimeout with a duration such as "1m".  A zero duration removes the bound.
+	rpcTimeoutEnv = "COSI_GRPC_TIMEOUT"
+
+	// A failed claim is requeued after backoffBase, doubling with each consecutive failure up to backoffCap.
+	backoffBase = 5 * time.Second
+	backoffCap  = 5 * time.Minute
+)
+
+// requeueAfterError carries a failure the reconciler recovers from by trying again later.  Reconcile maps it onto
+// reconcile.Result.RequeueAfter rather than returning it to the workqueue, whose own backoff is not per claim.
+type requeueAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *requeueAfterError) Error() string { return e.err.Error() }
+
+func (e *requeueAfterError) Unwrap() error { return e.err }
+
+// requeueAfter returns err wrapped so that the claim is retried after a backoff for the given number of consecutive
+// failures.
+func requeueAfter(err error, failures int) error {
+	return &requeueAfterError{err: err, after: backoff(failures)}
+}
+
+// backoff returns the delay before the next attempt after the given number of consecutive failures.
+func backoff(failures int) time.Duration {
+	d := backoffBase
+	for i := 1; i < failures && d < backoffCap; i++ {
+		d *= 2
+	}
+	if d > backoffCap {
+		d = backoffCap
+	}
+	return d
+}
+
+// isUnavailable reports plugin errors that may succeed on retry because the request never completed: the plugin could
+// not be reached or did not answer in time.
+func isUnavailable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// isTerminal reports plugin errors that retrying the same request cannot fix.
+func isTerminal(err error) bool {
+	var le *layoutError
+	if errors.As(err, &le) || isNotOwned(err) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.AlreadyExists:
+		return true
+	}
+	return false
+}
+
+// rpcContext derives the context of a single plugin call from ctx, bounded by the reconciler's RPC timeout.
+func (r *ReconcileObjectBucketClaim) rpcContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.rpcTimeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.rpcTimeout)
+}
+
+// durationFromEnv returns the positive or zero duration set by env, falling back to def if it is unset or invalid.
+func durationFromEnv(env string, def time.Duration) time.Duration {
+	v, ok := os.LookupEnv(env)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		Log.Info("invalid duration, using default", "env", env, "value", v, "default", def.String())
+		return def
+	}
+	return d
+}
@@ -0,0 +1,67 @@
+package objectbucketclaim
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: backoffBase},
+		{failures: 1, want: backoffBase},
+		{failures: 2, want: 2 * backoffBase},
+		{failures: 4, want: 8 * backoffBase},
+		{failures: 100, want: backoffCap},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyPluginErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		unavailable bool
+		terminal    bool
+	}{
+		{name: "unavailable", err: status.Error(codes.Unavailable, ""), unavailable: true},
+		{name: "deadline exceeded", err: status.Error(codes.DeadlineExceeded, ""), unavailable: true},
+		{name: "invalid argument", err: status.Error(codes.InvalidArgument, ""), terminal: true},
+		{name: "already exists", err: status.Error(codes.AlreadyExists, ""), terminal: true},
+		{name: "internal", err: status.Error(codes.Internal, "")},
+		{name: "not a status", err: errors.New("conflict")},
+		{name: "nil", err: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUnavailable(tt.err); got != tt.unavailable {
+				t.Errorf("isUnavailable() = %v, want %v", got, tt.unavailable)
+			}
+			if got := isTerminal(tt.err); got != tt.terminal {
+				t.Errorf("isTerminal() = %v, want %v", got, tt.terminal)
+			}
+		})
+	}
+}
+
+func TestRequeueAfterUnwraps(t *testing.T) {
+	cause := errors.New("cause")
+	err := requeueAfter(cause, 1)
+	var retry *requeueAfterError
+	if !errors.As(err, &retry) || retry.after != backoffBase {
+		t.Fatalf("requeueAfter() = %#v, want requeueAfterError after %v", err, backoffBase)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("requeueAfter() does not wrap its cause")
+	}
+}
@@ -0,0 +1,456 @@
+package objectbucketclaim
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	. "github.com/yard-turkey/cosi-prototype-driver/pkg/controller/objectbucketclaim/requestLogger"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
+)
+
+const (
+	// defaultRotationOverlap is how long replaced credentials stay valid if the StorageClass does not say.  Replaced
+	// credentials are revoked at the first resync after the overlap.
+	defaultRotationOverlap = 24 * time.Hour
+	// maxRotationHistory bounds the rotations kept in OB status.
+	maxRotationHistory = 10
+	// sessionRefreshWindow is how long before they expire session credentials are replaced.
+	sessionRefreshWindow = 15 * time.Minute
+)
+
+// Credentials are rotated by asking the plugin's accessClient for new ones and revoking the replaced ones by key ID, and
+// only with plugins that support plugin.CapabilityCredentialRotation.
+
+// rotationPolicy is the credential rotation configured on a StorageClass.
+type rotationPolicy struct {
+	// period between scheduled rotations, or zero if credentials are only rotated on request.
+	period time.Duration
+	// overlap during which the replaced credentials remain valid.
+	overlap time.Duration
+}
+
+func rotationPolicyFor(sc *storagev1.StorageClass) (rotationPolicy, error) {
+	policy := rotationPolicy{overlap: defaultRotationOverlap}
+	var err error
+	if v, ok := sc.Parameters[v1alpha1.StorageClassCredentialRotationPeriod]; ok {
+		if policy.period, err = parseRotationDuration(v); err != nil {
+			return policy, fmt.Errorf("invalid %s: %v", v1alpha1.StorageClassCredentialRotationPeriod, err)
+		}
+	}
+	if v, ok := sc.Parameters[v1alpha1.StorageClassCredentialRotationOverlap]; ok {
+		if policy.overlap, err = parseRotationDuration(v); err != nil {
+			return policy, fmt.Errorf("invalid %s: %v", v1alpha1.StorageClassCredentialRotationOverlap, err)
+		}
+	}
+	return policy, nil
+}
+
+// parseRotationDuration parses a time.Duration, or a whole number of days such as "90d", since rotation policies are
+// usually stated in days.
+func parseRotationDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration %q is negative", s)
+	}
+	return d, nil
+}
+
+func lastRotation(ob *v1alpha1.ObjectBucket) *v1alpha1.CredentialRotation {
+	rotations := ob.Status.CredentialRotations
+	if len(rotations) == 0 {
+		return nil
+	}
+	return &rotations[len(rotations)-1]
+}
+
+// lastRequest returns the RotateCredentialsAnnotation value of the most recent requested rotation.
+func lastRequest(ob *v1alpha1.ObjectBucket) string {
+	rotations := ob.Status.CredentialRotations
+	for i := len(rotations) - 1; i >= 0; i-- {
+		if rotations[i].Trigger == v1alpha1.CredentialRotationRequested {
+			return rotations[i].Request
+		}
+	}
+	return ""
+}
+
+// rotationDue returns the trigger of the rotation due for the claim at now, if any, given when the current credentials
+// expire, or the zero time if they do not.  A new rotation is not started while the credentials replaced by the last
+// one are still valid, so at most two sets are ever valid at once.
+func rotationDue(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, policy rotationPolicy, expires, now time.Time) (v1alpha1.CredentialRotationTrigger, string) {
+	last := lastRotation(ob)
+	if last != nil && last.RevokedAt == nil {
+		return "", ""
+	}
+	if req := obc.Annotations[v1alpha1.RotateCredentialsAnnotation]; req != "" && req != lastRequest(ob) {
+		return v1alpha1.CredentialRotationRequested, req
+	}
+	if !expires.IsZero() && !now.Before(expires.Add(-sessionRefreshWindow)) {
+		return v1alpha1.CredentialRotationExpiring, ""
+	}
+	if policy.period > 0 {
+		since := ob.CreationTimestamp.Time
+		if last != nil {
+			since = last.RotatedAt.Time
+		}
+		if !now.Before(since.Add(policy.period)) {
+			return v1alpha1.CredentialRotationScheduled, ""
+		}
+	}
+	return "", ""
+}
+
+// credentialKeyID returns the ID the plugin knows the credentials by, which is what it is asked to revoke.  Only key
+// pairs carry one.
+func credentialKeyID(auth *v1alpha1.Authentication) string {
+	switch {
+	case auth.AccessKeys != nil:
+		return auth.AccessKeys.AccessKeyID
+	case auth.SessionCredentials != nil:
+		return auth.SessionCredentials.AccessKeyID
+	}
+	return ""
+}
+
+// credentialsExpiration returns when the credentials stop being valid, or the zero time if they do not expire.  Only
+// session credentials carry an expiry.
+func credentialsExpiration(auth *v1alpha1.Authentication) time.Time {
+	if auth.SessionCredentials == nil {
+		return time.Time{}
+	}
+	return auth.SessionCredentials.Expiration.Time
+}
+
+// appendRotation adds rotation to the history, dropping the oldest entries beyond maxRotationHistory.
+func appendRotation(history []v1alpha1.CredentialRotation, rotation v1alpha1.CredentialRotation) []v1alpha1.CredentialRotation {
+	history = append(history, rotation)
+	if len(history) > maxRotationHistory {
+		history = history[len(history)-maxRotationHistory:]
+	}
+	return history
+}
+
+// nextCredentialsSync returns how long after now the claim's credentials are next due to be revoked or rotated, or
+// zero if they are not.  No rotation is due while the credentials replaced by the last one are still valid.  Expiring
+// credentials are due to be rotated sessionRefreshWindow before they expire.
+func nextCredentialsSync(ob *v1alpha1.ObjectBucket, policy rotationPolicy, expires, now time.Time) time.Duration {
+	var at time.Time
+	if last := lastRotation(ob); last != nil && last.RevokedAt == nil {
+		at = last.RevokeAfter.Time
+	} else {
+		if policy.period > 0 {
+			at = ob.CreationTimestamp.Add(policy.period)
+			if last != nil {
+				at = last.RotatedAt.Add(policy.period)
+			}
+		}
+		if refresh := expires.Add(-sessionRefreshWindow); !expires.IsZero() && (at.IsZero() || refresh.Before(at)) {
+			at = refresh
+		}
+		if at.IsZero() {
+			return 0
+		}
+	}
+	// Anything due now was attempted by this sync, so it is retried after a moment rather than at once.
+	if d := at.Sub(now); d > time.Second {
+		return d
+	}
+	return time.Second
+}
+
+// syncCredentials settles a rotation left pending by an interrupted sync, revokes the credentials replaced by the last
+// rotation once their overlap has passed, then rotates the credentials of a bound claim if a rotation is due.  It
+// returns the time until the credentials are next due to be revoked or rotated.
+func (r *ReconcileObjectBucketClaim) syncCredentials(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, sc *storagev1.StorageClass, p *pluginClient) (time.Duration, error) {
+	policy, err := rotationPolicyFor(sc)
+	if err != nil {
+		r.reportRotationFailure(obc, err.Error())
+		// The overlap of rotations already made still applies.
+		policy = rotationPolicy{overlap: defaultRotationOverlap}
+	}
+	if err := r.settlePendingRotation(obc, ob, p, policy); err != nil {
+		return 0, err
+	}
+	if err := r.revokeReplacedCredentials(obc, ob, p); err != nil {
+		return 0, err
+	}
+	expires := r.currentCredentialsExpiration(ob)
+	trigger, request := rotationDue(obc, ob, policy, expires, time.Now())
+	switch {
+	case trigger == "":
+	case !p.supports(plugin.CapabilityCredentialRotation):
+		r.reportRotationFailure(obc, fmt.Sprintf("plugin %q does not support credential rotation", sc.Provisioner))
+	default:
+		if err := p.health.Healthy(); err != nil {
+			r.reportExpiredCredentials(obc, expires)
+			return 0, r.holdForPlugin(obc, p, err)
+		}
+		if err := r.rotateCredentials(obc, ob, p, policy, trigger, request); err != nil {
+			r.reportExpiredCredentials(obc, expires)
+			return 0, err
+		}
+		expires = r.currentCredentialsExpiration(ob)
+	}
+	r.reportExpiredCredentials(obc, expires)
+	return nextCredentialsSync(ob, policy, expires, time.Now()), nil
+}
+
+// currentCredentialsExpiration returns when the OB's current credentials expire, or the zero time if they do not or
+// cannot be read.
+func (r *ReconcileObjectBucketClaim) currentCredentialsExpiration(ob *v1alpha1.ObjectBucket) time.Time {
+	current, err := r.objectBucketCredentials(ob)
+	if err != nil {
+		return time.Time{}
+	}
+	return credentialsExpiration(current)
+}
+
+// reportExpiredCredentials marks the claim's credentials as not ready once expires has passed, which happens when they
+// could not be replaced in time.
+func (r *ReconcileObjectBucketClaim) reportExpiredCredentials(obc *v1alpha1.ObjectBucketClaim, expires time.Time) {
+	if expires.IsZero() || time.Now().Before(expires) {
+		return
+	}
+	msg := fmt.Sprintf("credentials expired at %s", expires.UTC().Format(time.RFC3339))
+	before := obc.Status.DeepCopy()
+	setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionFalse, reasonCredentialsExpired, msg)
+	if reflect.DeepEqual(before, &obc.Status) {
+		return
+	}
+	r.recorder.Event(obc, corev1.EventTypeWarning, eventCredentialsExpired, msg)
+	r.updateClaimConditions(obc)
+}
+
+// rotateCredentials asks the plugin for new credentials and puts them in place of the current ones.  The rotation is
+// recorded as pending before the Secrets are updated, so that a sync interrupted part way settles it rather than
+// rotating again, which would leave the original credentials unrevoked.
+func (r *ReconcileObjectBucketClaim) rotateCredentials(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, p *pluginClient, policy rotationPolicy, trigger v1alpha1.CredentialRotationTrigger, request string) error {
+	current, err := r.objectBucketCredentials(ob)
+	if errors.Is(err, errNoCredentialsRef) {
+		r.reportRotationFailure(obc, err.Error())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	previousID := credentialKeyID(current)
+	if previousID == "" {
+		r.reportRotationFailure(obc, "the current credentials have no key ID to revoke them by")
+		return nil
+	}
+	if expires := credentialsExpiration(current); !expires.IsZero() && time.Until(expires) < policy.overlap {
+		// Expiring credentials are not kept past their expiry, so the next refresh is not held up by the overlap.
+		policy.overlap = 0
+		if d := time.Until(expires); d > 0 {
+			policy.overlap = d
+		}
+	}
+
+	bucket := r.releasedBucketName(obc, ob)
+	Log.Info("rotating credentials", "BucketName", bucket, "trigger", trigger)
+	var params map[string]string
+	if ob.Spec.Endpoint != nil {
+		params = ob.Spec.Endpoint.AdditionalConfigData
+	}
+	rpcCtx, cancel := r.rpcContext(r.ctx)
+	resp, err := p.access.grantAccess(rpcCtx, bucket, params)
+	cancel()
+	setClaimPluginReachable(obc, err)
+	if err != nil {
+		r.reportRotationFailure(obc, errorMessage(err))
+		return err
+	}
+	auth := v1alpha1.NewAuthentication(resp.GetEnvironmentCredentials())
+	keyID := credentialKeyID(auth)
+	if keyID == "" || keyID == previousID {
+		// The issued credentials cannot be told apart from the current ones, so they are not put in place.
+		r.reportRotationFailure(obc, "plugin did not issue credentials with a new key ID")
+		return nil
+	}
+
+	now := metav1.Now()
+	ob.Status.CredentialRotations = appendRotation(ob.Status.CredentialRotations, v1alpha1.CredentialRotation{
+		Trigger:       trigger,
+		Request:       request,
+		RotatedAt:     now,
+		KeyID:         keyID,
+		PreviousKeyID: previousID,
+		RevokeAfter:   metav1.NewTime(now.Add(policy.overlap)),
+		Pending:       true,
+	})
+	if err := r.writeObjectBucketStatus(ob); err != nil {
+		// Nothing uses the new credentials yet, and without a record they would never be revoked.
+		if revokeErr := r.revokeKey(obc, p, bucket, keyID); revokeErr != nil {
+			Log.Error(revokeErr, "failed to revoke unused credentials", "keyID", keyID)
+		}
+		return err
+	}
+	return r.completeRotation(obc, ob, policy, auth)
+}
+
+// completeRotation puts auth, the credentials issued by the pending last rotation, in place and records the rotation
+// as complete.  The overlap of the replaced credentials starts once the new ones are in place.
+func (r *ReconcileObjectBucketClaim) completeRotation(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, policy rotationPolicy, auth *v1alpha1.Authentication) error {
+	if err := r.updateCredentialsSecret(ob, auth); err != nil {
+		r.reportRotationFailure(obc, err.Error())
+		return err
+	}
+	if _, err := r.syncChildSecret(obc, ob); err != nil {
+		r.reportRotationFailure(obc, err.Error())
+		return err
+	}
+
+	rotation := lastRotation(ob)
+	now := metav1.Now()
+	rotation.Pending = false
+	rotation.RotatedAt = now
+	rotation.RevokeAfter = metav1.NewTime(now.Add(policy.overlap))
+	if err := r.writeObjectBucketStatus(ob); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("credentials rotated to key %q, key %q will be revoked after %s", rotation.KeyID, rotation.PreviousKeyID,
+		rotation.RevokeAfter.UTC().Format(time.RFC3339))
+	r.recorder.Event(obc, corev1.EventTypeNormal, eventCredentialsRotated, msg)
+	r.recorder.Event(ob, corev1.EventTypeNormal, eventCredentialsRotated, msg)
+	setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionTrue, reasonCredentialsRotated, msg)
+	r.updateClaimConditions(obc)
+	return nil
+}
+
+// settlePendingRotation finishes a rotation that was interrupted after it was recorded.  If the OB's credentials
+// Secret already holds the new credentials, the rotation is completed.  Otherwise the new credentials were lost before
+// anything could use them, so they are revoked and the rotation dropped, leaving it to be made again.
+func (r *ReconcileObjectBucketClaim) settlePendingRotation(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, p *pluginClient, policy rotationPolicy) error {
+	last := lastRotation(ob)
+	if last == nil || !last.Pending {
+		return nil
+	}
+	current, err := r.objectBucketCredentials(ob)
+	if err != nil {
+		return err
+	}
+	if credentialKeyID(current) == last.KeyID {
+		Log.Info("completing interrupted rotation", "keyID", last.KeyID)
+		return r.completeRotation(obc, ob, policy, current)
+	}
+
+	Log.Info("abandoning interrupted rotation", "keyID", last.KeyID)
+	if !p.supports(plugin.CapabilityCredentialRotation) {
+		r.reportRotationFailure(obc, fmt.Sprintf("plugin no longer supports credential rotation, unused key %q was not revoked", last.KeyID))
+		return nil
+	}
+	if err := p.health.Healthy(); err != nil {
+		return r.holdForPlugin(obc, p, err)
+	}
+	if err := r.revokeKey(obc, p, r.releasedBucketName(obc, ob), last.KeyID); err != nil {
+		r.reportRotationFailure(obc, fmt.Sprintf("revoking unused key %q: %s", last.KeyID, errorMessage(err)))
+		return err
+	}
+	ob.Status.CredentialRotations = ob.Status.CredentialRotations[:len(ob.Status.CredentialRotations)-1]
+	return r.writeObjectBucketStatus(ob)
+}
+
+// revokeReplacedCredentials revokes the credentials replaced by the last rotation once its overlap window has passed.
+func (r *ReconcileObjectBucketClaim) revokeReplacedCredentials(obc *v1alpha1.ObjectBucketClaim, ob *v1alpha1.ObjectBucket, p *pluginClient) error {
+	last := lastRotation(ob)
+	if last == nil || last.Pending || last.RevokedAt != nil || time.Now().Before(last.RevokeAfter.Time) {
+		return nil
+	}
+	if !p.supports(plugin.CapabilityCredentialRotation) {
+		r.reportRotationFailure(obc, fmt.Sprintf("plugin no longer supports credential rotation, key %q was not revoked", last.PreviousKeyID))
+		return nil
+	}
+	if err := p.health.Healthy(); err != nil {
+		return r.holdForPlugin(obc, p, err)
+	}
+
+	if err := r.revokeKey(obc, p, r.releasedBucketName(obc, ob), last.PreviousKeyID); err != nil {
+		r.reportRotationFailure(obc, fmt.Sprintf("revoking key %q: %s", last.PreviousKeyID, errorMessage(err)))
+		return err
+	}
+
+	now := metav1.Now()
+	last.RevokedAt = &now
+	if err := r.writeObjectBucketStatus(ob); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("replaced key %q revoked", last.PreviousKeyID)
+	r.recorder.Event(obc, corev1.EventTypeNormal, eventCredentialsRevoked, msg)
+	r.recorder.Event(ob, corev1.EventTypeNormal, eventCredentialsRevoked, msg)
+	return nil
+}
+
+// revokeKey asks the plugin to revoke the credentials with keyID from the claim's bucket.  Credentials the plugin no
+// longer knows count as revoked.
+func (r *ReconcileObjectBucketClaim) revokeKey(obc *v1alpha1.ObjectBucketClaim, p *pluginClient, bucket, keyID string) error {
+	Log.Info("revoking credentials", "BucketName", bucket, "keyID", keyID)
+	rpcCtx, cancel := r.rpcContext(r.ctx)
+	defer cancel()
+	err := p.access.revokeAccess(rpcCtx, bucket, keyID)
+	setClaimPluginReachable(obc, err)
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return err
+}
+
+// updateCredentialsSecret replaces the data of the OB's credentials Secret with auth.
+func (r *ReconcileObjectBucketClaim) updateCredentialsSecret(ob *v1alpha1.ObjectBucket, auth *v1alpha1.Authentication) error {
+	ref := ob.Spec.CredentialsSecretRef
+	if ref == nil {
+		return errNoCredentialsRef
+	}
+	sec := new(corev1.Secret)
+	err := r.apiReader.Get(r.ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, sec)
+	if err != nil {
+		return err
+	}
+	if err := checkController(sec, ob, "Secret"); err != nil {
+		return err
+	}
+	data := make(map[string][]byte)
+	for k, v := range auth.ToMap() {
+		data[k] = []byte(v)
+	}
+	return r.patchObject(sec, func() error {
+		sec.Data = data
+		return nil
+	})
+}
+
+// reportRotationFailure records why the claim's credentials could not be rotated or revoked.  The current credentials
+// remain valid, so CredentialsReady stays True.  A failure that persists across resyncs, such as a misconfigured
+// StorageClass, is only reported once.
+func (r *ReconcileObjectBucketClaim) reportRotationFailure(obc *v1alpha1.ObjectBucketClaim, msg string) {
+	Log.Info("credential rotation failed", "reason", msg)
+	before := obc.Status.DeepCopy()
+	setClaimCondition(obc, v1alpha1.ConditionCredentialsReady, corev1.ConditionTrue, reasonRotationFailed, msg)
+	if reflect.DeepEqual(before, &obc.Status) {
+		return
+	}
+	r.recorder.Event(obc, corev1.EventTypeWarning, eventRotationFailed, msg)
+	r.updateClaimConditions(obc)
+}
@@ -0,0 +1,58 @@
+package objectbucketclaim
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/yard-turkey/cosi-prototype-interface/cosi"
+)
+
+// defaultProvisionRetryBudget is the number of failed provisioning attempts tolerated for a claim before the completed
+// steps are rolled back and the claim is marked Failed.
+const defaultProvisionRetryBudget = 5
+
+// provisionTransaction records a claim's progress through provisioning across reconcile attempts.
+type provisionTransaction struct {
+	// failures counts the failed attempts charged to the retry budget.  Attempts the plugin never answered are not
+	// charged, so that an outage of the plugin does not roll back claims, but are still counted in attempts, which
+	// drives the backoff.
+	failures int
+	attempts int
+	// provisioned caches the plugin's response so that retries do not request the bucket a second time.  The bucket's
+	// name is also recorded in the claim's status, which outlives the transaction.
+	provisioned *cosi.ProvisionResponse
+	// brownfield is set when the claim binds an existing bucket, in which case provisioned holds access credentials
+	// only and rolling back revokes them rather than deleting the bucket.
+	brownfield bool
+}
+
+// transactionTracker holds the provisionTransactions of claims that have not yet been bound, keyed by claim UID so
+// that a claim recreated under the same name starts over.  State is held in memory only; restarting the driver resets
+// the retry budget of claims in progress, but not their record of a provisioned bucket, which is kept on the claim.
+type transactionTracker struct {
+	mu  sync.Mutex
+	txs map[types.UID]*provisionTransaction
+}
+
+func newTransactionTracker() *transactionTracker {
+	return &transactionTracker{txs: make(map[types.UID]*provisionTransaction)}
+}
+
+// get returns the transaction for uid, starting a new one if none is in progress.
+func (t *transactionTracker) get(uid types.UID) *provisionTransaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tx, ok := t.txs[uid]
+	if !ok {
+		tx = new(provisionTransaction)
+		t.txs[uid] = tx
+	}
+	return tx
+}
+
+func (t *transactionTracker) forget(uid types.UID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.txs, uid)
+}
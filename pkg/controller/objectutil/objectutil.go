@@ -0,0 +1,33 @@
+// Package objectutil holds helpers for the objects written by both the objectbucketclaim and objectbucket controllers.
+package objectutil
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MergeFromWithOptimisticLock returns a merge patch against the current state of obj that also carries obj's
+// resourceVersion, so that the api server rejects the patch with a Conflict if obj is stale.  Without the lock, a merge
+// patch of a list such as metadata.finalizers would overwrite entries added by other writers.
+func MergeFromWithOptimisticLock(obj runtime.Object) client.Patch {
+	base := obj.DeepCopyObject()
+	if m, err := meta.Accessor(base); err == nil {
+		m.SetResourceVersion("")
+	}
+	return client.MergeFrom(base)
+}
+
+// HasFinalizer reports whether obj carries finalizer.
+func HasFinalizer(obj runtime.Object, finalizer string) bool {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	for _, f := range m.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"sort"
+	"strings"
+)
+
+// Capability names an optional feature a plugin may support beyond provisioning and deprovisioning buckets.  Plugins
+// are to report theirs through a GetPluginCapabilities RPC modelled on CSI's, once the cosi Provisioner service
+// defines one; until then no plugin has any.
+type Capability string
+
+const (
+	// CapabilityBrownfield is support for granting and revoking access to existing buckets.
+	CapabilityBrownfield Capability = "BROWNFIELD"
+	// CapabilityCredentialRotation is support for issuing new credentials for a provisioned bucket.
+	CapabilityCredentialRotation Capability = "CREDENTIAL_ROTATION"
+	// CapabilityForceEmpty is support for deleting a bucket along with its objects.
+	CapabilityForceEmpty Capability = "FORCE_EMPTY"
+	// CapabilityQuota is support for the quota parameter.
+	CapabilityQuota Capability = "QUOTA"
+	// CapabilityVersioning is support for the versioning parameter.
+	CapabilityVersioning Capability = "VERSIONING"
+)
+
+// Capabilities is the set of optional features a plugin supports.
+type Capabilities map[Capability]bool
+
+// Has reports whether c includes capability.
+func (c Capabilities) Has(capability Capability) bool {
+	return c[capability]
+}
+
+// Missing returns the capabilities of required that c lacks, in order.
+func (c Capabilities) Missing(required ...Capability) []Capability {
+	var missing []Capability
+	for _, r := range required {
+		if !c.Has(r) {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+func (c Capabilities) String() string {
+	names := make([]string, 0, len(c))
+	for capability, ok := range c {
+		if ok {
+			names = append(names, string(capability))
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
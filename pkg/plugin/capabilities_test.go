@@ -0,0 +1,21 @@
+package plugin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCapabilitiesMissing(t *testing.T) {
+	c := Capabilities{CapabilityBrownfield: true, CapabilityVersioning: true}
+	got := c.Missing(CapabilityQuota, CapabilityBrownfield, CapabilityCredentialRotation)
+	want := []Capability{CapabilityQuota, CapabilityCredentialRotation}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Missing() = %v, want %v", got, want)
+	}
+	if got := c.Missing(CapabilityVersioning); got != nil {
+		t.Errorf("Missing() = %v, want nil", got)
+	}
+	if got, want := c.String(), "BROWNFIELD,VERSIONING"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+// Package plugin connects the driver to its provisioner plugin over gRPC.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var log = logf.Log.WithName("plugin")
+
+const (
+	ENV_LISTEN    = "COSI_GRPC_LISTEN"
+	listenDefault = "localhost:8080"
+
+	// unixScheme prefixes listen addresses naming a unix domain socket, e.g. unix:///var/lib/cosi/cosi.sock
+	unixScheme = "unix://"
+	// unixAuthority stands in for the host of socket connections, in the dial target and for TLS verification.
+	unixAuthority      = "localhost"
+	socketPollInterval = time.Second
+)
+
+// Dial opens a connection to the plugin at the endpoint's address, either host:port or unix:///path/to/socket, secured
+// with the endpoint's TLS settings.  For a socket, Dial waits until ctx is done for the socket file to appear, then
+// connects regardless; gRPC keeps retrying the socket in the background.  Only invalid TLS settings are an error.  The
+// caller owns the connection and must close it.
+func Dial(ctx context.Context, e Endpoint) (*grpc.ClientConn, error) {
+	listen := e.Address
+	log.Info("connecting to plugin", "address", listen)
+	target, host := listen, listen
+	var opts []grpc.DialOption
+	if path, ok := unixSocketPath(listen); ok {
+		if err := waitForSocket(ctx, path); err != nil {
+			log.Error(err, "connecting to plugin socket in the background")
+		}
+		target, host = "passthrough:///"+unixAuthority, unixAuthority
+		opts = append(opts, unixDialer(path))
+	}
+	transport, err := transportOption(host, e.tls)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, transport)
+	// The connection is not awaited, so ctx only bounds the wait for the socket.
+	return grpc.DialContext(context.Background(), target, opts...)
+}
+
+// unixSocketPath returns the socket path of a unix:// listen address, or false for a host:port address.
+func unixSocketPath(listen string) (string, bool) {
+	if !strings.HasPrefix(listen, unixScheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(listen, unixScheme), true
+}
+
+// waitForSocket polls for the socket file until ctx expires.  A plugin running as a sidecar creates the socket once it
+// is serving, and containers in a pod are not started in any particular order.
+func waitForSocket(ctx context.Context, path string) error {
+	ticker := time.NewTicker(socketPollInterval)
+	defer ticker.Stop()
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		log.V(1).Info("waiting for plugin socket", "path", path)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("plugin socket %s did not appear: %v", path, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// unixDialer connects to the socket at path whatever the dial target, which only serves as the connection's authority.
+func unixDialer(path string) grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	})
+}
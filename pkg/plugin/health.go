@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/yard-turkey/cosi-prototype-interface/cosi"
+)
+
+const (
+	// DefaultProbeInterval is how often the plugin's health is checked.
+	DefaultProbeInterval = 10 * time.Second
+	// probeTimeout bounds a single health check.
+	probeTimeout = 5 * time.Second
+)
+
+var errNotProbed = errors.New("plugin health has not been checked yet")
+
+// pluginHealthy reports the result of each plugin's last health check.
+var pluginHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "cosi_plugin_healthy",
+	Help: "Whether the plugin passed its last health check (1) or not (0).",
+}, []string{"plugin"})
+
+func init() {
+	metrics.Registry.MustRegister(pluginHealthy)
+}
+
+// Prober periodically checks the health of the plugin.  It uses the standard gRPC health protocol, falling back to
+// GetPluginName for plugins that do not implement it.  The Registry runs the Prober of each of its plugins, and reports
+// the result on the manager's readiness endpoint.
+type Prober struct {
+	name        string
+	health      healthpb.HealthClient
+	provisioner cosi.ProvisionerClient
+	interval    time.Duration
+
+	// useHealthService is cleared once the plugin reports the health service is unimplemented.  It is only accessed
+	// from the probing goroutine.
+	useHealthService bool
+
+	mu  sync.RWMutex
+	err error
+}
+
+// NewProber returns a Prober checking the plugin called name through health and provisioner every interval.
+func NewProber(name string, health healthpb.HealthClient, provisioner cosi.ProvisionerClient, interval time.Duration) *Prober {
+	return &Prober{
+		name:             name,
+		health:           health,
+		provisioner:      provisioner,
+		interval:         interval,
+		useHealthService: true,
+		err:              errNotProbed,
+	}
+}
+
+// Start probes the plugin every interval until stop is closed.
+func (p *Prober) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.probe()
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Interval returns the period between checks.
+func (p *Prober) Interval() time.Duration {
+	return p.interval
+}
+
+// Healthy returns the error of the last check, or nil if the plugin passed it.
+func (p *Prober) Healthy() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.err
+}
+
+func (p *Prober) probe() {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	err := p.check(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case err != nil && p.err == nil:
+		log.Error(err, "plugin became unhealthy", "plugin", p.name)
+	case err == nil && p.err != nil:
+		log.Info("plugin is healthy", "plugin", p.name)
+	}
+	p.err = err
+	if err == nil {
+		pluginHealthy.WithLabelValues(p.name).Set(1)
+	} else {
+		pluginHealthy.WithLabelValues(p.name).Set(0)
+	}
+}
+
+func (p *Prober) check(ctx context.Context) error {
+	if p.useHealthService {
+		resp, err := p.health.Check(ctx, &healthpb.HealthCheckRequest{})
+		switch {
+		case status.Code(err) == codes.Unimplemented:
+			log.Info("plugin does not implement the gRPC health service, probing with GetPluginName", "plugin", p.name)
+			p.useHealthService = false
+		case err != nil:
+			return err
+		case resp.GetStatus() != healthpb.HealthCheckResponse_SERVING:
+			return fmt.Errorf("plugin health status is %s", resp.GetStatus())
+		default:
+			return nil
+		}
+	}
+	_, err := p.provisioner.GetPluginName(ctx, &cosi.PluginNameRequest{})
+	return err
+}
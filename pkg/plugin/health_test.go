@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/yard-turkey/cosi-prototype-interface/cosi"
+)
+
+type fakeHealthClient struct {
+	healthpb.HealthClient
+	resp  *healthpb.HealthCheckResponse
+	err   error
+	calls int
+}
+
+func (f *fakeHealthClient) Check(context.Context, *healthpb.HealthCheckRequest, ...grpc.CallOption) (*healthpb.HealthCheckResponse, error) {
+	f.calls++
+	return f.resp, f.err
+}
+
+type fakeProvisioner struct {
+	cosi.ProvisionerClient
+	name  string
+	err   error
+	calls int
+}
+
+func (f *fakeProvisioner) GetPluginName(context.Context, *cosi.PluginNameRequest, ...grpc.CallOption) (*cosi.PluginNameResponse, error) {
+	f.calls++
+	return &cosi.PluginNameResponse{Name: f.name}, f.err
+}
+
+func TestProberHealthService(t *testing.T) {
+	health := &fakeHealthClient{resp: &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}}
+	provisioner := &fakeProvisioner{}
+	p := NewProber("test", health, provisioner, time.Second)
+	if p.Healthy() == nil {
+		t.Error("Healthy() = nil before the first probe")
+	}
+
+	p.probe()
+	if err := p.Healthy(); err != nil {
+		t.Errorf("Healthy() = %v with a serving plugin", err)
+	}
+
+	health.resp.Status = healthpb.HealthCheckResponse_NOT_SERVING
+	p.probe()
+	if p.Healthy() == nil {
+		t.Error("Healthy() = nil with a plugin not serving")
+	}
+	if provisioner.calls != 0 {
+		t.Errorf("GetPluginName called %d times, want 0 while the health service is implemented", provisioner.calls)
+	}
+}
+
+func TestProberFallsBackToPluginName(t *testing.T) {
+	health := &fakeHealthClient{err: status.Error(codes.Unimplemented, "")}
+	provisioner := &fakeProvisioner{}
+	p := NewProber("test", health, provisioner, time.Second)
+
+	p.probe()
+	p.probe()
+	if err := p.Healthy(); err != nil {
+		t.Errorf("Healthy() = %v with a reachable plugin", err)
+	}
+	if health.calls != 1 || provisioner.calls != 2 {
+		t.Errorf("got %d health checks and %d GetPluginName calls, want 1 and 2", health.calls, provisioner.calls)
+	}
+
+	provisioner.err = status.Error(codes.Unavailable, "")
+	p.probe()
+	if p.Healthy() == nil {
+		t.Error("Healthy() = nil with an unreachable plugin")
+	}
+}
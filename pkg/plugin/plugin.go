@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/yard-turkey/cosi-prototype-interface/cosi"
+)
+
+// Plugin is a connection to a provisioner plugin, with a client for its provisioning calls and a Prober of its health.
+// A plugin not reachable when the driver starts is kept, and reported unhealthy, until it reports its name.
+type Plugin struct {
+	// Name is the plugin's name, matched against StorageClass provisioners.  It is the name given for the plugin's
+	// Endpoint, or else the name reported by GetPluginName, and is set before the plugin is registered.
+	Name    string
+	Address string
+
+	conn   *grpc.ClientConn
+	Client cosi.ProvisionerClient
+	Health *Prober
+
+	mu sync.RWMutex
+	// discoverErr is why the plugin's name is not known yet, or nil once it is.
+	discoverErr error
+}
+
+// Connect dials the plugin at the endpoint and discovers its name, waiting until ctx is done for the
+// plugin to come up.  See Dial.  A plugin that does not come up in time is still returned, with the error it gave; it
+// is reached later by the Registry.  Only an endpoint that cannot be dialled at all is an error.  The Prober of a named
+// plugin is returned stopped; the Registry starts it.
+func Connect(ctx context.Context, e Endpoint) (*Plugin, error) {
+	conn, err := Dial(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	p := &Plugin{
+		Name:    e.Name,
+		Address: e.Address,
+		conn:    conn,
+		Client:  cosi.NewProvisionerClient(conn),
+	}
+	if err := p.discover(ctx); err != nil {
+		log.Error(err, "plugin not reached, retrying in the background", "address", e.Address)
+	}
+	return p, nil
+}
+
+// discover asks the plugin for its name.  A plugin whose endpoint names it must report that name.
+func (p *Plugin) discover(ctx context.Context) error {
+	resp, err := p.Client.GetPluginName(ctx, &cosi.PluginNameRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		err = fmt.Errorf("getting plugin name: %v", err)
+	} else if p.Name != "" && resp.Name != p.Name {
+		err = fmt.Errorf("plugin at %s reports the name %q, not %q", p.Address, resp.Name, p.Name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.discoverErr = err
+	if err != nil {
+		return err
+	}
+	if p.Name == "" {
+		p.Name = resp.Name
+	}
+	return nil
+}
+
+// discovered reports whether the plugin's name is known.
+func (p *Plugin) discovered() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.discoverErr == nil
+}
+
+// Capabilities returns the optional features the plugin supports.  The cosi Provisioner service has no
+// GetPluginCapabilities RPC to ask for them yet, so none are known and claims needing them are refused.
+func (p *Plugin) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+// Healthy returns nil if the plugin has been reached and passed its last health check.
+func (p *Plugin) Healthy() error {
+	p.mu.RLock()
+	err := p.discoverErr
+	p.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("plugin has not been reached: %v", err)
+	}
+	return p.Health.Healthy()
+}
+
+// Interval returns the period between health checks.
+func (p *Plugin) Interval() time.Duration {
+	return p.Health.Interval()
+}
+
+// ReadyzCheck fails while the plugin is unhealthy.
+func (p *Plugin) ReadyzCheck(_ *http.Request) error {
+	return p.Healthy()
+}
+
+// newProber returns the Prober of a plugin whose name is known.
+func (p *Plugin) newProber() *Prober {
+	return NewProber(p.Name, healthpb.NewHealthClient(p.conn), p.Client, DefaultProbeInterval)
+}
+
+// Close closes the connection to the plugin.
+func (p *Plugin) Close() error {
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
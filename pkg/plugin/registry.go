@@ -0,0 +1,241 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// Endpoint is where a plugin is served, as listed in ENV_LISTEN.
+type Endpoint struct {
+	// Name is the name the plugin must report, or "" if it is learnt from the plugin.  Claims can only be routed to a
+	// plugin that is unreachable at startup if its name is given.
+	Name    string
+	Address string
+
+	tls tlsOptions
+}
+
+// Endpoints returns the plugin endpoints set by ENV_LISTEN, a comma separated list of addresses each optionally
+// prefixed by the plugin's name and "=", as in "s3.example.com=unix:///var/lib/cosi/s3.sock".  The default is a single
+// unnamed plugin at localhost:8080.  See tlsOptionsFromEnv for the TLS settings of each.
+func Endpoints() ([]Endpoint, error) {
+	v, ok := os.LookupEnv(ENV_LISTEN)
+	if !ok {
+		return []Endpoint{{Address: listenDefault, tls: tlsOptionsFromEnv("")}}, nil
+	}
+	var endpoints []Endpoint
+	for _, l := range strings.Split(v, ",") {
+		if l = strings.TrimSpace(l); l == "" {
+			continue
+		}
+		e := Endpoint{Address: l}
+		if i := strings.Index(l, "="); i >= 0 {
+			e.Name, e.Address = strings.TrimSpace(l[:i]), strings.TrimSpace(l[i+1:])
+			if e.Name == "" || e.Address == "" {
+				return nil, fmt.Errorf("invalid plugin endpoint %q in %s, want [name=]address", l, ENV_LISTEN)
+			}
+		}
+		e.tls = tlsOptionsFromEnv(e.Name)
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, nil
+}
+
+// discoveryInterval is how often plugins not reached yet are retried.
+const discoveryInterval = DefaultProbeInterval
+
+// Registry holds the plugins served by the driver, keyed by name.  Claims are routed to the plugin named by their
+// StorageClass's provisioner.  Registry is a manager.Runnable: once started it probes the health of its plugins and
+// keeps trying to reach those that were not reachable at startup.
+type Registry struct {
+	mu      sync.RWMutex
+	plugins map[string]*Plugin
+	// pending are the plugins whose endpoint gives no name and which have not reported one yet, so that nothing can be
+	// routed to them.
+	pending []*Plugin
+	// probing are the plugins whose Prober has been started.
+	probing map[*Plugin]bool
+}
+
+func newRegistry() *Registry {
+	return &Registry{plugins: make(map[string]*Plugin), probing: make(map[*Plugin]bool)}
+}
+
+// ConnectAll connects to the plugin at each of the endpoints, waiting up to timeout for each to come up.  The plugins
+// are connected concurrently, so that one that is down does not hold up the others.  A plugin that cannot be reached is
+// registered unhealthy under the endpoint's name, or held until it reports its name, rather than failing startup.  Two
+// plugins with the same name are an error, since claims could not be routed between them.
+func ConnectAll(ctx context.Context, endpoints []Endpoint, timeout time.Duration) (*Registry, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no plugin addresses set in %s", ENV_LISTEN)
+	}
+	plugins := make([]*Plugin, len(endpoints))
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, e := range endpoints {
+		wg.Add(1)
+		go func(i int, e Endpoint) {
+			defer wg.Done()
+			dialCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			plugins[i], errs[i] = Connect(dialCtx, e)
+		}(i, e)
+	}
+	wg.Wait()
+
+	reg := newRegistry()
+	for i, e := range endpoints {
+		err := errs[i]
+		if err != nil {
+			err = fmt.Errorf("connecting to plugin at %s: %v", e.Address, err)
+		} else if err = reg.add(plugins[i]); err == nil {
+			continue
+		}
+		for _, p := range plugins[i:] {
+			if p != nil {
+				p.Close()
+			}
+		}
+		reg.Close()
+		return nil, err
+	}
+	return reg, nil
+}
+
+// add registers p under its name, or holds it as pending if its name is not known yet.
+func (r *Registry) add(p *Plugin) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p.Name == "" {
+		log.Info("plugin name not known yet, claims are not routed to it until it is reached", "address", p.Address)
+		r.pending = append(r.pending, p)
+		return nil
+	}
+	if other, ok := r.plugins[p.Name]; ok {
+		return fmt.Errorf("plugins at %s and %s both report the name %q", other.Address, p.Address, p.Name)
+	}
+	if p.Health == nil {
+		p.Health = p.newProber()
+	}
+	r.plugins[p.Name] = p
+	log.Info("registered plugin", "name", p.Name, "address", p.Address)
+	return nil
+}
+
+// Start probes the registered plugins and retries those not reached yet every discoveryInterval, until stop is closed.
+func (r *Registry) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+	for {
+		r.discover()
+		for _, p := range r.Plugins() {
+			if !r.probing[p] {
+				r.probing[p] = true
+				go p.Health.Start(stop)
+			}
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// discover retries the plugins not reached yet.  A pending plugin is registered once it reports its name.
+func (r *Registry) discover() {
+	r.mu.RLock()
+	var retry []*Plugin
+	for _, p := range r.plugins {
+		if !p.discovered() {
+			retry = append(retry, p)
+		}
+	}
+	pending := append([]*Plugin(nil), r.pending...)
+	r.mu.RUnlock()
+
+	for _, p := range append(retry, pending...) {
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		err := p.discover(ctx)
+		cancel()
+		if err != nil {
+			log.V(1).Info("plugin not reached", "address", p.Address, "reason", err.Error())
+		}
+	}
+
+	for _, p := range pending {
+		if !p.discovered() {
+			continue
+		}
+		r.mu.Lock()
+		for i := range r.pending {
+			if r.pending[i] == p {
+				r.pending = append(r.pending[:i], r.pending[i+1:]...)
+				break
+			}
+		}
+		r.mu.Unlock()
+		if err := r.add(p); err != nil {
+			log.Error(err, "plugin not registered")
+			p.Close()
+		}
+	}
+}
+
+// Get returns the plugin with the given name.
+func (r *Registry) Get(name string) (*Plugin, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.plugins[name]
+	return p, ok
+}
+
+// Plugins returns the registered plugins ordered by name.
+func (r *Registry) Plugins() []*Plugin {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	plugins := make([]*Plugin, 0, len(r.plugins))
+	for _, p := range r.plugins {
+		plugins = append(plugins, p)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// ReadyzCheck returns a readiness check of the plugin served at address, which fails until the plugin is registered
+// and then while it is unhealthy.
+func (r *Registry) ReadyzCheck(address string) healthz.Checker {
+	return func(req *http.Request) error {
+		for _, p := range r.Plugins() {
+			if p.Address == address {
+				return p.ReadyzCheck(req)
+			}
+		}
+		return fmt.Errorf("plugin at %s has not reported its name", address)
+	}
+}
+
+// Close closes the connections to all plugins, returning the first error.
+func (r *Registry) Close() error {
+	r.mu.RLock()
+	plugins := append([]*Plugin(nil), r.pending...)
+	for _, p := range r.plugins {
+		plugins = append(plugins, p)
+	}
+	r.mu.RUnlock()
+	var first error
+	for _, p := range plugins {
+		if err := p.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
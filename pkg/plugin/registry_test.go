@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEndpoints(t *testing.T) {
+	for _, key := range []string{ENV_LISTEN, ENV_TLS_CA, ENV_TLS_CA + "_S3_EXAMPLE_COM"} {
+		defer os.Unsetenv(key)
+	}
+	os.Setenv(ENV_TLS_CA, "/etc/cosi/ca.crt")
+	os.Setenv(ENV_TLS_CA+"_S3_EXAMPLE_COM", "/etc/cosi/s3-ca.crt")
+
+	tests := []struct {
+		name    string
+		listen  string
+		want    []Endpoint
+		wantErr bool
+	}{
+		{
+			name:   "unnamed",
+			listen: "unix:///var/lib/cosi/cosi.sock",
+			want:   []Endpoint{{Address: "unix:///var/lib/cosi/cosi.sock", tls: tlsOptions{caFile: "/etc/cosi/ca.crt"}}},
+		}, {
+			name:   "named with own TLS settings",
+			listen: "s3.example.com=unix:///var/lib/cosi/s3.sock, gcs.example.com = plugin:8080,",
+			want: []Endpoint{
+				{Name: "s3.example.com", Address: "unix:///var/lib/cosi/s3.sock", tls: tlsOptions{caFile: "/etc/cosi/s3-ca.crt"}},
+				{Name: "gcs.example.com", Address: "plugin:8080", tls: tlsOptions{caFile: "/etc/cosi/ca.crt"}},
+			},
+		}, {
+			name:    "name without address",
+			listen:  "s3.example.com=",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(ENV_LISTEN, tt.listen)
+			got, err := Endpoints()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Endpoints() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Endpoints() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// unreachablePlugin returns a plugin at address that has not answered yet.
+func unreachablePlugin(name, address string, provisioner *fakeProvisioner) *Plugin {
+	return &Plugin{
+		Name:        name,
+		Address:     address,
+		Client:      provisioner,
+		discoverErr: status.Error(codes.Unavailable, "connection refused"),
+	}
+}
+
+func TestRegistryAdd(t *testing.T) {
+	r := newRegistry()
+	named := unreachablePlugin("s3.example.com", "unix:///s3.sock", &fakeProvisioner{})
+	if err := r.add(named); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	p, ok := r.Get("s3.example.com")
+	if !ok {
+		t.Fatal("unreachable named plugin not registered")
+	}
+	if p.Healthy() == nil {
+		t.Error("Healthy() = nil for an unreachable plugin")
+	}
+
+	if err := r.add(unreachablePlugin("", "unix:///other.sock", &fakeProvisioner{})); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	if len(r.Plugins()) != 1 || len(r.pending) != 1 {
+		t.Errorf("unnamed plugin registered, want it pending")
+	}
+
+	if r.add(unreachablePlugin("s3.example.com", "unix:///again.sock", &fakeProvisioner{})) == nil {
+		t.Error("add() = nil for a duplicate name")
+	}
+}
+
+func TestRegistryDiscover(t *testing.T) {
+	r := newRegistry()
+	pending := unreachablePlugin("", "unix:///gcs.sock", &fakeProvisioner{name: "gcs.example.com"})
+	mismatched := unreachablePlugin("s3.example.com", "unix:///s3.sock", &fakeProvisioner{name: "minio"})
+	down := unreachablePlugin("azure.example.com", "unix:///azure.sock", &fakeProvisioner{err: errors.New("down")})
+	for _, p := range []*Plugin{pending, mismatched, down} {
+		if err := r.add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.discover()
+
+	p, ok := r.Get("gcs.example.com")
+	if !ok {
+		t.Fatal("pending plugin not registered once reached")
+	}
+	if len(r.pending) != 0 {
+		t.Errorf("pending = %v, want none", r.pending)
+	}
+	if r.ReadyzCheck("unix:///gcs.sock")(nil) == nil {
+		t.Error("ReadyzCheck() = nil before the first health check")
+	}
+	p.Health.err = nil
+	if err := r.ReadyzCheck("unix:///gcs.sock")(nil); err != nil {
+		t.Errorf("ReadyzCheck() = %v for a healthy plugin", err)
+	}
+
+	for _, name := range []string{"s3.example.com", "azure.example.com"} {
+		p, _ := r.Get(name)
+		if p.discovered() {
+			t.Errorf("plugin %s discovered, want it unreachable", name)
+		}
+		p.Health.err = nil
+		if r.ReadyzCheck(p.Address)(nil) == nil {
+			t.Errorf("ReadyzCheck() = nil for unreachable plugin %s", name)
+		}
+	}
+	if r.ReadyzCheck("unix:///unknown.sock")(nil) == nil {
+		t.Error("ReadyzCheck() = nil for an unknown address")
+	}
+}
+
+func TestRegistryGet(t *testing.T) {
+	r := newRegistry()
+	for _, p := range []*Plugin{
+		{Name: "s3.example.com", Address: "unix:///s3.sock"},
+		{Name: "gcs.example.com", Address: "unix:///gcs.sock"},
+	} {
+		p.Health = NewProber(p.Name, &fakeHealthClient{}, &fakeProvisioner{}, time.Second)
+		if err := r.add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, address := range map[string]string{"s3.example.com": "unix:///s3.sock", "gcs.example.com": "unix:///gcs.sock"} {
+		p, ok := r.Get(name)
+		if !ok || p.Address != address {
+			t.Errorf("Get(%q) = %+v, %v, want the plugin at %s", name, p, ok, address)
+		}
+	}
+	if _, ok := r.Get("other.example.com"); ok {
+		t.Error("Get() found a plugin this driver does not serve")
+	}
+	if got := r.Plugins(); len(got) != 2 || got[0].Name != "gcs.example.com" {
+		t.Errorf("Plugins() = %+v, want both ordered by name", got)
+	}
+}
@@ -0,0 +1,230 @@
+package plugin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// TLS settings for the connection to the plugin.  Setting any of them enables TLS; setting both ENV_TLS_CERT and
+// ENV_TLS_KEY also presents a client certificate for mutual TLS.  Without ENV_TLS_CA, the plugin's certificate is
+// verified against the system roots, so ENV_TLS_SERVER_NAME alone verifies a publicly trusted certificate.  Each may be set for a single named plugin; see tlsOptionsFromEnv.
+const (
+	ENV_TLS_CA          = "COSI_GRPC_TLS_CA"
+	ENV_TLS_CERT        = "COSI_GRPC_TLS_CERT"
+	ENV_TLS_KEY         = "COSI_GRPC_TLS_KEY"
+	ENV_TLS_SERVER_NAME = "COSI_GRPC_TLS_SERVER_NAME"
+)
+
+var errCertWithoutKey = errors.New(ENV_TLS_CERT + " and " + ENV_TLS_KEY + " must be set together")
+
+type tlsOptions struct {
+	caFile     string
+	certFile   string
+	keyFile    string
+	serverName string
+}
+
+// tlsOptionsFromEnv reads the TLS settings of the plugin called name.  Each ENV_TLS_* variable suffixed with "_" and
+// the name, upper cased and with every other character but letters and digits replaced by "_", applies to that plugin
+// only; COSI_GRPC_TLS_CA_S3_EXAMPLE_COM sets the CA bundle of plugin s3.example.com.  Settings not made for the plugin
+// are taken from the unsuffixed variables.  An unnamed plugin only uses the unsuffixed variables.
+func tlsOptionsFromEnv(name string) tlsOptions {
+	get := func(key string) string {
+		if name != "" {
+			if v, ok := os.LookupEnv(key + "_" + envSuffix(name)); ok {
+				return v
+			}
+		}
+		return os.Getenv(key)
+	}
+	return tlsOptions{
+		caFile:     get(ENV_TLS_CA),
+		certFile:   get(ENV_TLS_CERT),
+		keyFile:    get(ENV_TLS_KEY),
+		serverName: get(ENV_TLS_SERVER_NAME),
+	}
+}
+
+// envSuffix turns a plugin name into the suffix of its environment variables.
+func envSuffix(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func (o tlsOptions) enabled() bool {
+	return o.caFile != "" || o.certFile != "" || o.keyFile != "" || o.serverName != ""
+}
+
+// transportOption returns the dial option securing the connection to target.  Connections are insecure unless TLS is
+// configured, since the plugin is expected to share the driver's pod by default.
+func transportOption(target string, o tlsOptions) (grpc.DialOption, error) {
+	if !o.enabled() {
+		return grpc.WithInsecure(), nil
+	}
+	cfg, err := o.tlsConfig(target)
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(cfg)), nil
+}
+
+// tlsConfig builds a tls.Config that rereads the CA bundle and client key pair whenever they change on disk, so that
+// rotated certificates take effect on the next handshake without restarting the driver.
+func (o tlsOptions) tlsConfig(target string) (*tls.Config, error) {
+	if (o.certFile == "") != (o.keyFile == "") {
+		return nil, errCertWithoutKey
+	}
+	serverName := o.serverName
+	if serverName == "" {
+		serverName = hostFromTarget(target)
+	}
+	certs := &certReloader{caFile: o.caFile, certFile: o.certFile, keyFile: o.keyFile}
+	cfg := &tls.Config{ServerName: serverName}
+
+	if o.certFile != "" {
+		// Loading eagerly fails fast on a bad key pair instead of on the first handshake.
+		if _, err := certs.clientCertificate(nil); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = certs.clientCertificate
+	}
+	if o.caFile != "" {
+		if _, err := certs.rootCAs(); err != nil {
+			return nil, err
+		}
+		// The standard verification only accepts a fixed RootCAs pool.  It is skipped in favour of verifyPeer, which
+		// performs the same chain and host name checks against the current CA bundle.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = certs.verifyPeer(serverName)
+	}
+	return cfg, nil
+}
+
+// hostFromTarget returns the host of a host:port dial target, which the plugin's certificate must be valid for.
+func hostFromTarget(target string) string {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return target
+	}
+	return host
+}
+
+// certReloader caches the client key pair and CA bundle, reloading each when its files' modification time changes.
+type certReloader struct {
+	caFile   string
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	roots   *x509.CertPool
+	caMod   time.Time
+}
+
+func (c *certReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	mod, err := latestModTime(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if c.cert != nil && mod.Equal(c.certMod) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %v", err)
+	}
+	log.Info("loaded plugin client certificate", "cert", c.certFile)
+	c.cert, c.certMod = &cert, mod
+	return c.cert, nil
+}
+
+func (c *certReloader) rootCAs() (*x509.CertPool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	mod, err := latestModTime(c.caFile)
+	if err != nil {
+		return nil, err
+	}
+	if c.roots != nil && mod.Equal(c.caMod) {
+		return c.roots, nil
+	}
+	pem, err := ioutil.ReadFile(c.caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", c.caFile)
+	}
+	log.Info("loaded plugin CA bundle", "ca", c.caFile)
+	c.roots, c.caMod = roots, mod
+	return c.roots, nil
+}
+
+// verifyPeer verifies the plugin's certificate chain against the current CA bundle and checks it is valid for
+// serverName.
+func (c *certReloader) verifyPeer(serverName string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("plugin presented no certificate")
+		}
+		roots, err := c.rootCAs()
+		if err != nil {
+			return err
+		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			DNSName:       serverName,
+			Intermediates: x509.NewCertPool(),
+		}
+		var leaf *x509.Certificate
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				leaf = cert
+			} else {
+				opts.Intermediates.AddCert(cert)
+			}
+		}
+		_, err = leaf.Verify(opts)
+		return err
+	}
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSigned writes a self-signed certificate for host to path and returns it in DER form.
+func writeSelfSigned(t *testing.T, path, host string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestVerifyPeerReloadsCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cosi-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.crt")
+
+	oldCert := writeSelfSigned(t, caFile, "plugin.example.com")
+	cfg, err := tlsOptions{caFile: caFile}.tlsConfig("plugin.example.com:8080")
+	if err != nil {
+		t.Fatalf("tlsConfig() error = %v", err)
+	}
+	if err := cfg.VerifyPeerCertificate([][]byte{oldCert}, nil); err != nil {
+		t.Errorf("verifying certificate signed by the CA: %v", err)
+	}
+
+	// Rotate the CA, pushing the modification time forward in case the file system's resolution is coarse.
+	newCert := writeSelfSigned(t, caFile, "plugin.example.com")
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(caFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.VerifyPeerCertificate([][]byte{newCert}, nil); err != nil {
+		t.Errorf("verifying certificate signed by the rotated CA: %v", err)
+	}
+	if err := cfg.VerifyPeerCertificate([][]byte{oldCert}, nil); err == nil {
+		t.Error("certificate signed by the replaced CA was accepted")
+	}
+}
+
+func TestVerifyPeerChecksServerName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cosi-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.crt")
+	cert := writeSelfSigned(t, caFile, "plugin.example.com")
+
+	cfg, err := tlsOptions{caFile: caFile}.tlsConfig("10.0.0.1:8080")
+	if err != nil {
+		t.Fatalf("tlsConfig() error = %v", err)
+	}
+	if err := cfg.VerifyPeerCertificate([][]byte{cert}, nil); err == nil {
+		t.Error("certificate for another host was accepted")
+	}
+
+	cfg, err = tlsOptions{caFile: caFile, serverName: "plugin.example.com"}.tlsConfig("10.0.0.1:8080")
+	if err != nil {
+		t.Fatalf("tlsConfig() error = %v", err)
+	}
+	if err := cfg.VerifyPeerCertificate([][]byte{cert}, nil); err != nil {
+		t.Errorf("verifying with server name override: %v", err)
+	}
+}
+
+func TestTLSConfigRequiresKeyPair(t *testing.T) {
+	_, err := tlsOptions{certFile: "client.crt"}.tlsConfig("localhost:8080")
+	if err != errCertWithoutKey {
+		t.Errorf("tlsConfig() error = %v, want %v", err, errCertWithoutKey)
+	}
+}
+
+func TestServerNameEnablesTLS(t *testing.T) {
+	o := tlsOptions{serverName: "plugin.example.com"}
+	if !o.enabled() {
+		t.Fatal("enabled() = false with only a server name set")
+	}
+	cfg, err := o.tlsConfig("10.0.0.1:8080")
+	if err != nil {
+		t.Fatalf("tlsConfig() error = %v", err)
+	}
+	if cfg.ServerName != "plugin.example.com" || cfg.InsecureSkipVerify {
+		t.Errorf("tlsConfig() = %+v, want the certificate verified for plugin.example.com against the system roots", cfg)
+	}
+}
@@ -0,0 +1,10 @@
+package webhook
+
+import (
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/webhook/objectbucketclaim"
+)
+
+func init() {
+	// AddToManagerFuncs is a list of functions to create webhooks and add them to a manager.
+	AddToManagerFuncs = append(AddToManagerFuncs, objectbucketclaim.Add)
+}
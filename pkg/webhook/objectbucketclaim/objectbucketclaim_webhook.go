@@ -0,0 +1,220 @@
+package objectbucketclaim
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
+)
+
+var log = logf.Log.WithName("webhook_objectbucketclaim")
+
+// Path is where the claim validator is served.  The ValidatingWebhookConfiguration in deploy/webhook.yaml points here.
+const Path = "/validate-objectbucket-io-v1alpha1-objectbucketclaim"
+
+// Add registers a validator for the claims of registry's plugins with the Manager's webhook server.
+func Add(mgr manager.Manager, registry *plugin.Registry) error {
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	v := &claimValidator{
+		client:  mgr.GetClient(),
+		decoder: decoder,
+		serves: func(provisioner string) bool {
+			_, ok := registry.Get(provisioner)
+			return ok
+		},
+	}
+	mgr.GetWebhookServer().Register(Path, &webhook.Admission{Handler: v})
+	return nil
+}
+
+// claimValidator rejects claims that the reconciler would otherwise only fail once it synced them, and changes to a
+// bound claim that would detach it from its bucket.
+type claimValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+	// serves reports whether the named provisioner is one of the plugins served by this driver.
+	serves func(provisioner string) bool
+}
+
+var _ admission.Handler = &claimValidator{}
+
+func (v *claimValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obc := new(v1alpha1.ObjectBucketClaim)
+	if err := v.decoder.Decode(req, obc); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *v1alpha1.ObjectBucketClaim
+	if req.Operation == admissionv1beta1.Update {
+		old = new(v1alpha1.ObjectBucketClaim)
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	// The ObjectBucketClaim CRD may be shared with other drivers, whose claims are theirs to validate.  A claim moved
+	// to or from one of this driver's classes is validated here.
+	foreign, err := v.foreign(ctx, obc.Spec.StorageClassName)
+	if err == nil && foreign && old != nil {
+		foreign, err = v.foreign(ctx, old.Spec.StorageClassName)
+	}
+	if err != nil {
+		log.Error(err, "failed to validate claim", "Namespace", obc.Namespace, "Name", obc.Name)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if foreign {
+		return admission.Allowed("claim is not provisioned by this driver")
+	}
+
+	var errs []string
+	switch req.Operation {
+	case admissionv1beta1.Create:
+		errs, err = v.validateCreate(ctx, obc)
+	case admissionv1beta1.Update:
+		errs, err = v.validateUpdate(ctx, old, obc)
+	}
+	if err != nil {
+		log.Error(err, "failed to validate claim", "Namespace", obc.Namespace, "Name", obc.Name)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(errs) > 0 {
+		return admission.Denied(strings.Join(errs, "; "))
+	}
+	return admission.Allowed("")
+}
+
+// foreign reports whether the named StorageClass is provisioned by a driver other than this one.  A claim without a
+// StorageClass, or whose StorageClass does not exist, is not known to be another driver's.
+func (v *claimValidator) foreign(ctx context.Context, class string) (bool, error) {
+	if class == "" {
+		return false, nil
+	}
+	sc := new(storagev1.StorageClass)
+	err := v.client.Get(ctx, client.ObjectKey{Name: class}, sc)
+	if apierrs.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !v.serves(sc.Provisioner), nil
+}
+
+// servedClass reads the named StorageClass and checks that it belongs to one of this driver's plugins.  The reason is
+// set if the class is refused, the error only if the StorageClass could not be read.
+func (v *claimValidator) servedClass(ctx context.Context, class string) (sc *storagev1.StorageClass, reason string, err error) {
+	if class == "" {
+		return nil, "spec.storageClassName must be set", nil
+	}
+	sc = new(storagev1.StorageClass)
+	err = v.client.Get(ctx, client.ObjectKey{Name: class}, sc)
+	if apierrs.IsNotFound(err) {
+		return nil, fmt.Sprintf("StorageClass %q not found", class), nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if !v.serves(sc.Provisioner) {
+		return nil, fmt.Sprintf("StorageClass %q is provisioned by %q, which this driver does not serve", class, sc.Provisioner), nil
+	}
+	return sc, "", nil
+}
+
+// validateCreate checks a new claim's StorageClass and bucket name.  The error is only set if the StorageClass could
+// not be read.
+func (v *claimValidator) validateCreate(ctx context.Context, obc *v1alpha1.ObjectBucketClaim) ([]string, error) {
+	sc, reason, err := v.servedClass(ctx, obc.Spec.StorageClassName)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return []string{reason}, nil
+	}
+	var errs []string
+	name, prefix := obc.Spec.BucketName, obc.Spec.GenerateBucketName
+	bucket := sc.Parameters[v1alpha1.StorageClassBucket]
+	switch {
+	case name != "" && prefix != "":
+		errs = append(errs, "spec.bucketName and spec.generateBucketName are mutually exclusive")
+	case bucket != "":
+		// Brownfield classes name the bucket themselves.
+		if err := v1alpha1.ValidateBrownfieldClaim(obc, bucket); err != nil {
+			errs = append(errs, err.Error())
+		}
+	case name != "":
+		if err := v1alpha1.ValidateBucketName(name); err != nil {
+			errs = append(errs, "spec.bucketName: "+err.Error())
+		}
+	case prefix != "":
+		if err := v1alpha1.ValidateGenerateBucketName(prefix); err != nil {
+			errs = append(errs, "spec.generateBucketName: "+err.Error())
+		}
+	default:
+		errs = append(errs, "one of spec.bucketName or spec.generateBucketName must be set")
+	}
+	if err := v1alpha1.ValidateConnectionLayout(obc.Spec.ConnectionLayout); err != nil {
+		errs = append(errs, "spec.connectionLayout: "+err.Error())
+	}
+	return errs, nil
+}
+
+// validateUpdate keeps a bound claim attached to its bucket.  Before binding the reconciler fills in a generated
+// bucket name, so only a name that changes is checked.  The connection layout is recorded on the OB at binding, so it
+// cannot change afterwards either.  An unbound claim may move to another StorageClass, as long as this driver serves it
+// and, for a brownfield class, the claim asks for no other bucket;
+// the class is not read otherwise, so that a claim can still be released after its StorageClass was deleted.  The error
+// is only set if the StorageClass could not be read.
+func (v *claimValidator) validateUpdate(ctx context.Context, old, obc *v1alpha1.ObjectBucketClaim) ([]string, error) {
+	var errs []string
+	if old.IsBound() {
+		if obc.Spec.StorageClassName != old.Spec.StorageClassName {
+			errs = append(errs, "spec.storageClassName is immutable once the claim is bound")
+		}
+		if obc.Spec.BucketName != old.Spec.BucketName {
+			errs = append(errs, "spec.bucketName is immutable once the claim is bound")
+		}
+		if !reflect.DeepEqual(obc.Spec.ConnectionLayout, old.Spec.ConnectionLayout) {
+			errs = append(errs, "spec.connectionLayout is immutable once the claim is bound")
+		}
+	} else {
+		if obc.Spec.StorageClassName != old.Spec.StorageClassName {
+			sc, reason, err := v.servedClass(ctx, obc.Spec.StorageClassName)
+			if err != nil {
+				return nil, err
+			}
+			if reason != "" {
+				errs = append(errs, reason)
+			} else if bucket := sc.Parameters[v1alpha1.StorageClassBucket]; bucket != "" {
+				if err := v1alpha1.ValidateBrownfieldClaim(obc, bucket); err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+		}
+		if obc.Spec.BucketName != old.Spec.BucketName && obc.Spec.BucketName != "" {
+			if err := v1alpha1.ValidateBucketName(obc.Spec.BucketName); err != nil {
+				errs = append(errs, "spec.bucketName: "+err.Error())
+			}
+		}
+	}
+	if !reflect.DeepEqual(obc.Spec.ConnectionLayout, old.Spec.ConnectionLayout) {
+		if err := v1alpha1.ValidateConnectionLayout(obc.Spec.ConnectionLayout); err != nil {
+			errs = append(errs, "spec.connectionLayout: "+err.Error())
+		}
+	}
+	return errs, nil
+}
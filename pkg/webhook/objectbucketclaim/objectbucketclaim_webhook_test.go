@@ -0,0 +1,203 @@
+package objectbucketclaim
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/apis/objectbucket/v1alpha1"
+)
+
+const provisioner = "cosi.example.com"
+
+func newValidator(t *testing.T) *claimValidator {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	classes := []runtime.Object{
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "greenfield"}, Provisioner: provisioner},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "brownfield"},
+			Provisioner: provisioner,
+			Parameters:  map[string]string{v1alpha1.StorageClassBucket: "existing"},
+		},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "other"}, Provisioner: "other.example.com"},
+	}
+	return &claimValidator{
+		client:  fake.NewFakeClientWithScheme(scheme, classes...),
+		decoder: decoder,
+		serves:  func(p string) bool { return p == provisioner },
+	}
+}
+
+func claimRequest(t *testing.T, op admissionv1beta1.Operation, obc, old *v1alpha1.ObjectBucketClaim) admission.Request {
+	raw := func(obc *v1alpha1.ObjectBucketClaim) runtime.RawExtension {
+		if obc == nil {
+			return runtime.RawExtension{}
+		}
+		obc.APIVersion = v1alpha1.SchemeGroupVersion.String()
+		obc.Kind = "ObjectBucketClaim"
+		b, err := json.Marshal(obc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runtime.RawExtension{Raw: b}
+	}
+	return admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: op,
+		Object:    raw(obc),
+		OldObject: raw(old),
+	}}
+}
+
+func claim(class, bucket, prefix string) *v1alpha1.ObjectBucketClaim {
+	return &v1alpha1.ObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim"},
+		Spec: v1alpha1.ObjectBucketClaimSpec{
+			StorageClassName:   class,
+			BucketName:         bucket,
+			GenerateBucketName: prefix,
+		},
+	}
+}
+
+func withLayout(obc *v1alpha1.ObjectBucketClaim, from, to string) *v1alpha1.ObjectBucketClaim {
+	obc.Spec.ConnectionLayout = &v1alpha1.ConnectionLayout{Keys: map[string]string{from: to}}
+	return obc
+}
+
+func TestValidateCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		obc     *v1alpha1.ObjectBucketClaim
+		allowed bool
+	}{
+		{name: "bucket name", obc: claim("greenfield", "my-bucket", ""), allowed: true},
+		{name: "prefix", obc: claim("greenfield", "", "logs"), allowed: true},
+		{name: "brownfield without name", obc: claim("brownfield", "", ""), allowed: true},
+		{name: "brownfield with existing name", obc: claim("brownfield", "existing", ""), allowed: true},
+		{name: "brownfield with other name", obc: claim("brownfield", "my-bucket", "")},
+		{name: "brownfield with prefix", obc: claim("brownfield", "", "logs")},
+		{name: "no storage class", obc: claim("", "my-bucket", "")},
+		{name: "missing storage class", obc: claim("absent", "my-bucket", "")},
+		{name: "other provisioner", obc: claim("other", "My_Bucket", "logs"), allowed: true},
+		{name: "invalid bucket name", obc: claim("greenfield", "My_Bucket", "")},
+		{name: "invalid prefix", obc: claim("greenfield", "", "Logs")},
+		{name: "both names", obc: claim("greenfield", "my-bucket", "logs")},
+		{name: "no name", obc: claim("greenfield", "", "")},
+		{name: "connection layout", obc: withLayout(claim("greenfield", "my-bucket", ""), v1alpha1.BucketNameKey, "S3_BUCKET"), allowed: true},
+		{name: "invalid connection layout", obc: withLayout(claim("greenfield", "my-bucket", ""), "BUCKET", "S3_BUCKET")},
+	}
+	v := newValidator(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := v.Handle(context.Background(), claimRequest(t, admissionv1beta1.Create, tt.obc, nil))
+			if resp.Allowed != tt.allowed {
+				t.Errorf("Handle() allowed = %v, want %v (%v)", resp.Allowed, tt.allowed, resp.Result)
+			}
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	bound := func(obc *v1alpha1.ObjectBucketClaim) *v1alpha1.ObjectBucketClaim {
+		obc.Spec.ObjectBucketName = "obc-default-claim"
+		obc.Status.Phase = v1alpha1.ObjectBucketClaimStatusPhaseBound
+		return obc
+	}
+	tests := []struct {
+		name    string
+		old     *v1alpha1.ObjectBucketClaim
+		obc     *v1alpha1.ObjectBucketClaim
+		allowed bool
+	}{
+		{
+			name:    "generated name filled in before binding",
+			old:     claim("greenfield", "", "logs"),
+			obc:     claim("greenfield", "logs-x7k2q", "logs"),
+			allowed: true,
+		}, {
+			name:    "storage class changed before binding",
+			old:     claim("greenfield", "existing", ""),
+			obc:     claim("brownfield", "existing", ""),
+			allowed: true,
+		}, {
+			name: "storage class changed to another bucket's before binding",
+			old:  claim("greenfield", "my-bucket", ""),
+			obc:  claim("brownfield", "my-bucket", ""),
+		}, {
+			name: "invalid name set before binding",
+			old:  claim("greenfield", "", "logs"),
+			obc:  claim("greenfield", "Logs", "logs"),
+		}, {
+			name:    "bound claim unchanged",
+			old:     bound(claim("greenfield", "my-bucket", "")),
+			obc:     bound(claim("greenfield", "my-bucket", "")),
+			allowed: true,
+		}, {
+			name: "storage class changed after binding",
+			old:  bound(claim("greenfield", "my-bucket", "")),
+			obc:  bound(claim("brownfield", "my-bucket", "")),
+		}, {
+			name: "bucket name changed after binding",
+			old:  bound(claim("greenfield", "my-bucket", "")),
+			obc:  bound(claim("greenfield", "other-bucket", "")),
+		}, {
+			name:    "other provisioner's bound claim changed",
+			old:     bound(claim("other", "my-bucket", "")),
+			obc:     bound(claim("other", "other-bucket", "")),
+			allowed: true,
+		}, {
+			name: "other provisioner's bound claim moved to this driver",
+			old:  bound(claim("other", "my-bucket", "")),
+			obc:  bound(claim("greenfield", "other-bucket", "")),
+		}, {
+			name: "storage class changed to another provisioner's before binding",
+			old:  claim("greenfield", "my-bucket", ""),
+			obc:  claim("other", "my-bucket", ""),
+		}, {
+			name: "storage class changed to a missing one before binding",
+			old:  claim("greenfield", "my-bucket", ""),
+			obc:  claim("missing", "my-bucket", ""),
+		}, {
+			name:    "claim of a deleted storage class changed",
+			old:     claim("missing", "my-bucket", ""),
+			obc:     withLayout(claim("missing", "my-bucket", ""), v1alpha1.BucketNameKey, "S3_BUCKET"),
+			allowed: true,
+		}, {
+			name:    "connection layout changed before binding",
+			old:     claim("greenfield", "my-bucket", ""),
+			obc:     withLayout(claim("greenfield", "my-bucket", ""), v1alpha1.BucketNameKey, "S3_BUCKET"),
+			allowed: true,
+		}, {
+			name: "connection layout changed after binding",
+			old:  bound(claim("greenfield", "my-bucket", "")),
+			obc:  bound(withLayout(claim("greenfield", "my-bucket", ""), v1alpha1.BucketNameKey, "S3_BUCKET")),
+		},
+	}
+	v := newValidator(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := v.Handle(context.Background(), claimRequest(t, admissionv1beta1.Update, tt.obc, tt.old))
+			if resp.Allowed != tt.allowed {
+				t.Errorf("Handle() allowed = %v, want %v (%v)", resp.Allowed, tt.allowed, resp.Result)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package webhook
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/yard-turkey/cosi-prototype-driver/pkg/plugin"
+)
+
+// AddToManagerFuncs is a list of functions to add all admission webhooks to the Manager
+var AddToManagerFuncs []func(manager.Manager, *plugin.Registry) error
+
+// AddToManager registers all admission webhooks with the Manager's webhook server.  Webhooks that only admit claims
+// for this driver's plugins find them in registry.
+func AddToManager(m manager.Manager, registry *plugin.Registry) error {
+	for _, f := range AddToManagerFuncs {
+		if err := f(m, registry); err != nil {
+			return err
+		}
+	}
+	return nil
+}